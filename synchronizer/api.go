@@ -0,0 +1,14 @@
+package synchronizer
+
+import (
+	"context"
+)
+
+// apiContext bounds a single Kubernetes API call with --apiTimeout, so that a
+// hung API server fails the call instead of blocking the run.
+func (s *Synchronizer) apiContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Opts.APITimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.Opts.APITimeout)
+}
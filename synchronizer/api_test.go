@@ -0,0 +1,51 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAPIContext(t *testing.T) {
+	s := testSynchronizer(t, Opts{APITimeout: time.Minute})
+	ctx, cancel := s.apiContext(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("got deadline %s, %t, want within --apiTimeout", deadline, ok)
+	}
+
+	s = testSynchronizer(t, Opts{})
+	ctx, cancel = s.apiContext(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("got a deadline without --apiTimeout")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("context not cancelled")
+	}
+}
+
+func TestGetPVCsAPITimeout(t *testing.T) {
+	s := testSynchronizer(t, Opts{APITimeout: 30 * time.Second})
+	selection, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("list: %w", context.DeadlineExceeded)
+	})
+
+	_, err = s.getPVCs(context.Background(), client, "source", "efs-sc", selection, nil)
+	if want := "Couldn't list pvcs on source: list: context deadline exceeded (--apiTimeout of 30s exceeded)"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+	if ExitCode(err) != exitCluster {
+		t.Errorf("got %v, want a cluster error", err)
+	}
+}
@@ -0,0 +1,27 @@
+package synchronizer
+
+import "github.com/google/shlex"
+
+// splitArgs splits the value of --rsyncArgs or --mountArgs into arguments
+// the way a shell would, so that quoted values keep their spaces, e.g.
+// --exclude='*.tmp dir'. The value must have been checked by checkArgs.
+func splitArgs(args string) []string {
+	split, _ := shlex.Split(args)
+	return split
+}
+
+// checkArgs returns an error when --rsyncArgs or --mountArgs can't be split
+// into arguments, e.g. because of an unclosed quote, or when
+// --summaryWebhookTemplate isn't a valid template.
+func checkArgs(opts *Opts) error {
+	if _, err := shlex.Split(opts.RsyncArgs); err != nil {
+		return configError("Invalid --rsyncArgs "+opts.RsyncArgs, err)
+	}
+	if _, err := shlex.Split(opts.MountArgs); err != nil {
+		return configError("Invalid --mountArgs "+opts.MountArgs, err)
+	}
+	if _, err := parseWebhookTemplate(opts.SummaryWebhookTemplate); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package synchronizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"", []string{}},
+		{"-rulpEto", []string{"-rulpEto"}},
+		{"  -a   --delete ", []string{"-a", "--delete"}},
+		{"-a --exclude='*.tmp dir'", []string{"-a", "--exclude=*.tmp dir"}},
+		{`-a --exclude="cache dir/"`, []string{"-a", "--exclude=cache dir/"}},
+		{`-t nfs4 -o nfsvers=4.1,hard`, []string{"-t", "nfs4", "-o", "nfsvers=4.1,hard"}},
+		{`--exclude=a\ b`, []string{"--exclude=a b"}},
+	}
+	for _, test := range tests {
+		if got := splitArgs(test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q): got %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want int
+	}{
+		{"default", Opts{RsyncArgs: "-rulpEto", MountArgs: "-t nfs4 -o nfsvers=4.1"}, exitOK},
+		{"quoted", Opts{RsyncArgs: "-a --exclude='*.tmp dir'", MountArgs: `-t efs -o "tls,iam"`}, exitOK},
+		{"unclosed rsync quote", Opts{RsyncArgs: "-a --exclude='*.tmp"}, exitConfig},
+		{"unclosed mount quote", Opts{MountArgs: `-t efs -o "tls`}, exitConfig},
+	}
+	for _, test := range tests {
+		if err := checkArgs(&test.opts); ExitCode(err) != test.want {
+			t.Errorf("%s: got %v, want exit code %d", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// betaStorageClassAnnotation is the storage class annotation that predates
+// spec.storageClassName.
+const betaStorageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+
+// betaAnnotationDeprecatedSince is the first Kubernetes version whose API
+// server warns about betaStorageClassAnnotation, from which it is stripped by
+// --betaStorageClassAnnotation=auto.
+var betaAnnotationDeprecatedSince = version.MustParseGeneric("1.24")
+
+// stripsBetaAnnotation tells whether the pvcs created on the cluster of
+// clientset get betaStorageClassAnnotation stripped: always with mode strip,
+// never with keep, and with auto when the server version, read through
+// Discovery within --apiTimeout, is at least betaAnnotationDeprecatedSince.
+func (s *Synchronizer) stripsBetaAnnotation(ctx context.Context, clientset kubernetes.Interface, clusterContext, mode string) (bool, error) {
+	switch mode {
+	case "strip":
+		return true, nil
+	case "keep":
+		return false, nil
+	}
+	gitVersion, err := s.serverVersion(ctx, clientset)
+	if err != nil {
+		return false, clusterError("Couldn't get the Kubernetes version of "+clusterContext, err)
+	}
+	serverVersion, err := version.ParseGeneric(gitVersion)
+	if err != nil {
+		return false, clusterError("Couldn't parse the Kubernetes version of "+clusterContext, err)
+	}
+	strip := serverVersion.AtLeast(betaAnnotationDeprecatedSince)
+	if strip {
+		s.log(fmt.Sprintf("%s runs Kubernetes %s, stripping the %s annotation from created pvcs", clusterContext, gitVersion, betaStorageClassAnnotation))
+	}
+	return strip, nil
+}
+
+// serverVersion reads the git version of the API server of clientset, giving up
+// when --apiTimeout is exceeded or ctx is done since ServerVersion takes no
+// context.
+func (s *Synchronizer) serverVersion(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	type result struct {
+		gitVersion string
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		info, err := clientset.Discovery().ServerVersion()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{gitVersion: info.GitVersion}
+	}()
+	select {
+	case result := <-done:
+		return result.gitVersion, result.err
+	case <-apiCtx.Done():
+		return "", s.cancelled(ctx, apiCtx.Err())
+	}
+}
+
+// withoutBetaAnnotation removes betaStorageClassAnnotation from pvc, moving
+// its storage class to spec.storageClassName when that isn't set.
+func withoutBetaAnnotation(pvc *v1.PersistentVolumeClaim) {
+	storageClass, ok := pvc.ObjectMeta.Annotations[betaStorageClassAnnotation]
+	if !ok {
+		return
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		pvc.Spec.StorageClassName = &storageClass
+	}
+	delete(pvc.ObjectMeta.Annotations, betaStorageClassAnnotation)
+}
@@ -0,0 +1,124 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStripsBetaAnnotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		gitVersion string
+		want       bool
+		wantCode   int
+	}{
+		{"strip", "strip", "v1.20.0", true, exitOK},
+		{"keep", "keep", "v1.30.0", false, exitOK},
+		{"auto before deprecation", "auto", "v1.23.17-eks-1234", false, exitOK},
+		{"auto on deprecation", "auto", "v1.24.0", true, exitOK},
+		{"auto after deprecation", "auto", "v1.30.2-eks-abcd", true, exitOK},
+		{"auto unparsable", "auto", "unknown", false, exitCluster},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, Opts{})
+			client := fake.NewSimpleClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: test.gitVersion}
+
+			got, err := s.stripsBetaAnnotation(context.Background(), client, "target", test.mode)
+			if got != test.want || ExitCode(err) != test.wantCode {
+				t.Errorf("got %t, %v, want %t with exit code %d", got, err, test.want, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestStripsBetaAnnotationServerVersionError(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "version", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	if _, err := s.stripsBetaAnnotation(context.Background(), client, "target", "auto"); ExitCode(err) != exitCluster {
+		t.Errorf("got %v, want a cluster error", err)
+	}
+	if got, err := s.stripsBetaAnnotation(context.Background(), client, "target", "keep"); got || err != nil {
+		t.Errorf("got %t, %v with keep, want the version not read", got, err)
+	}
+}
+
+func TestStripsBetaAnnotationAPITimeout(t *testing.T) {
+	s := testSynchronizer(t, Opts{APITimeout: 50 * time.Millisecond})
+	client := fake.NewSimpleClientset()
+	hung := make(chan struct{})
+	defer close(hung)
+	client.PrependReactor("get", "version", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-hung
+		return true, nil, errors.New("connection reset")
+	})
+
+	_, err := s.stripsBetaAnnotation(context.Background(), client, "target", "auto")
+	if want := "Couldn't get the Kubernetes version of target: context deadline exceeded (--apiTimeout of 50ms exceeded)"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+	if ExitCode(err) != exitCluster {
+		t.Errorf("got %v, want a cluster error", err)
+	}
+}
+
+func TestWithoutBetaAnnotation(t *testing.T) {
+	tests := []struct {
+		name string
+		pvc  func() *v1.PersistentVolumeClaim
+		want string
+	}{
+		{"annotation only", func() *v1.PersistentVolumeClaim { return testPVC("default", "data", withBetaStorageClass("efs-sc")) }, "efs-sc"},
+		{"both", func() *v1.PersistentVolumeClaim {
+			return testPVC("default", "data", withBetaStorageClass("efs-sc"), withStorageClass("efs-spec"))
+		}, "efs-spec"},
+		{"empty storage class name", func() *v1.PersistentVolumeClaim {
+			return testPVC("default", "data", withBetaStorageClass("efs-sc"), withStorageClass(""))
+		}, "efs-sc"},
+		{"spec only", func() *v1.PersistentVolumeClaim { return testPVC("default", "data", withStorageClass("efs-spec")) }, "efs-spec"},
+	}
+	for _, test := range tests {
+		pvc := test.pvc()
+		withoutBetaAnnotation(pvc)
+		if _, ok := pvc.Annotations[betaStorageClassAnnotation]; ok {
+			t.Errorf("%s: annotation kept", test.name)
+		}
+		if got := pvc.Spec.StorageClassName; got == nil || *got != test.want {
+			t.Errorf("%s: got spec.storageClassName %v, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewTargetPVCStripsBetaAnnotation(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	source := testPVC("default", "data", withBetaStorageClass("efs-sc"))
+
+	target, err := s.newTargetPVC("efs-target", true, "default/data", *source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := target.Annotations[betaStorageClassAnnotation]; ok {
+		t.Error("annotation kept")
+	}
+	if got := target.Spec.StorageClassName; got == nil || *got != "efs-target" {
+		t.Errorf("got spec.storageClassName %v, want efs-target", got)
+	}
+	if source.Annotations[betaStorageClassAnnotation] != "efs-sc" {
+		t.Error("source pvc changed")
+	}
+}
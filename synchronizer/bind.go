@@ -0,0 +1,59 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// bindPollInterval is how often the target pvcs are listed again while
+// waiting for them to be bound.
+const bindPollInterval = 5 * time.Second
+
+// unboundTargets returns the sorted keys of the target pvcs of pvcsSource
+// that exist but aren't bound to a volume yet.
+func (s *Synchronizer) unboundTargets(pvcsSource, pvcsTarget map[string]v1.PersistentVolumeClaim) []string {
+	unbound := make([]string, 0)
+	for sourceIndex := range pvcsSource {
+		targetIndex := s.nameMapping.target(sourceIndex)
+		targetPVC, ok := pvcsTarget[targetIndex]
+		if ok && (targetPVC.Status.Phase != v1.ClaimBound || targetPVC.Spec.VolumeName == "") {
+			unbound = append(unbound, targetIndex)
+		}
+	}
+	sort.Strings(unbound)
+	return unbound
+}
+
+// waitForBound lists the target pvcs again until all the ones of pvcsSource
+// are bound or --bindTimeout is over. The pvcs still unbound then are
+// recorded in target.unbound, to be reported at the end of the run.
+func (s *Synchronizer) waitForBound(ctx context.Context, target *target, selection *pvcSelection, pvcsSource map[string]v1.PersistentVolumeClaim) error {
+	deadline := time.Now().Add(s.Opts.BindTimeout)
+	for {
+		unbound := s.unboundTargets(pvcsSource, target.pvcs)
+		if len(unbound) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			target.unbound = unbound
+			s.warn(fmt.Sprintf("%d pvcs not bound on %s after --bindTimeout of %s: %s", len(unbound), target.context, s.Opts.BindTimeout, strings.Join(unbound, ", ")))
+			return nil
+		}
+		s.log(fmt.Sprintf("waiting for %d pvcs to be bound on %s...", len(unbound), target.context))
+		select {
+		case <-time.After(bindPollInterval):
+		case <-ctx.Done():
+			return clusterError("Stopped waiting for pvcs to be bound", s.cancelled(ctx, ctx.Err()))
+		}
+		pvcs, err := s.getPVCs(ctx, target.client, target.context, target.storageClass, selection, s.nameMapping)
+		if err != nil {
+			return err
+		}
+		target.pvcs = pvcs
+	}
+}
@@ -0,0 +1,236 @@
+package synchronizer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// checkpointLog is a file listing, one per line, the top-level subdirs of
+// source volumes whose rsync completed, so that a rerun after an interruption
+// skips them. Each line is keyed by checkpointKey with the target volume dir
+// too, since a subdir rsynced to a target may be missing on another one. The
+// subdirs of a volume are forgotten once the whole volume is rsynced to a
+// target, so that the next run synchronizes it again.
+type checkpointLog struct {
+	mu   sync.Mutex
+	path string
+	done map[string]bool
+}
+
+// checkCheckpointArgs rejects the options that can't be combined with
+// --checkpointLog, since they change what a rerun copies or where, nor with
+// --intraVolumeParallelism, since both rsync volumes subdir by subdir.
+func checkCheckpointArgs(opts *Opts) error {
+	if opts.IntraVolumeParallelism < 1 {
+		return configError("parse error", fmt.Errorf("--intraVolumeParallelism must be at least 1, got %d", opts.IntraVolumeParallelism))
+	}
+	if opts.Snapshots || opts.SampleFiles > 0 || opts.ExcludeNewerThanStart {
+		if opts.CheckpointLog != "" {
+			return configError("parse error", errors.New("--checkpointLog can't be combined with --snapshots, --sampleFiles nor --excludeNewerThanStart"))
+		}
+		if opts.IntraVolumeParallelism > 1 {
+			return configError("parse error", errors.New("--intraVolumeParallelism can't be combined with --snapshots, --sampleFiles nor --excludeNewerThanStart"))
+		}
+	}
+	return nil
+}
+
+// loadCheckpointLog reads the subdirs already rsynced from path, which may not
+// exist yet.
+func loadCheckpointLog(path string) (*checkpointLog, error) {
+	c := &checkpointLog{path: path, done: make(map[string]bool)}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			c.done[line] = true
+		}
+	}
+	return c, scanner.Err()
+}
+
+// checkpointKey is the line of the log recording that the subdir child of
+// dirSource was rsynced to dirTarget.
+func checkpointKey(dirSource, dirTarget, child string) string {
+	return filepath.Clean(dirTarget) + "\t" + filepath.Join(dirSource, child)
+}
+
+func (c *checkpointLog) isDone(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[key]
+}
+
+// markDone appends key, from checkpointKey, to the log.
+func (c *checkpointLog) markDone(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(key + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	c.done[key] = true
+	return nil
+}
+
+// forget removes the subdirs of dirSource rsynced to dirTarget from the log,
+// rewriting it atomically.
+func (c *checkpointLog) forget(dirSource, dirTarget string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := checkpointKey(dirSource, dirTarget, "") + string(os.PathSeparator)
+	kept := make([]string, 0, len(c.done))
+	for key := range c.done {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.done, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	sort.Strings(kept)
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	temporary := c.path + ".tmp"
+	if err := os.WriteFile(temporary, []byte(content), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, c.path)
+}
+
+// childDirs returns the names of the immediate subdirectories of dir, sorted.
+func childDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// rsyncByChild rsyncs every top-level subdir of dirSource on its own, up to
+// --intraVolumeParallelism at the same time and skipping the ones of the
+// checkpoint log for dirTarget, then the rest of the volume with these subdirs excluded:
+// its top-level files, the attributes of the volume dir itself and the
+// subdirs created or removed in the meantime, which that last pass copies or,
+// with --deleteExtraneous, deletes.
+func (s *Synchronizer) rsyncByChild(ctx context.Context, args []string, dirSource, dirTarget string) (rsyncStats, error) {
+	children, err := childDirs(dirSource)
+	if err != nil {
+		s.log("Couldn't list the subdirs of " + dirSource)
+		s.printLine(withHint(err))
+		return rsyncStats{}, err
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		stats    rsyncStats
+		firstErr error
+	)
+	excludes := make([]string, 0, len(children))
+	workers := make(chan struct{}, max(s.Opts.IntraVolumeParallelism, 1))
+	for _, child := range children {
+		exclude := "--exclude=/" + escapeRsyncPattern(child) + "/"
+		subdir := filepath.Join(dirSource, child)
+		key := checkpointKey(dirSource, dirTarget, child)
+		if s.checkpoints != nil && s.checkpoints.isDone(key) {
+			s.log("skipping " + subdir + ", already rsynced as recorded in " + s.checkpoints.path)
+			mu.Lock()
+			excludes = append(excludes, exclude)
+			mu.Unlock()
+			continue
+		}
+		mu.Lock()
+		stop := firstErr != nil
+		mu.Unlock()
+		if stop {
+			break
+		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			childStats, err := s.runRsync(ctx, args, subdir, dirTarget)
+			mu.Lock()
+			defer mu.Unlock()
+			stats.add(childStats)
+			if err != nil && ctx.Err() == nil {
+				if _, statErr := os.Stat(subdir); errors.Is(statErr, os.ErrNotExist) {
+					s.log(subdir + " was removed while rsyncing it, leaving it to the last rsync of " + dirSource)
+					return
+				}
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			excludes = append(excludes, exclude)
+			if s.Opts.DryRun || s.checkpoints == nil {
+				return
+			}
+			if err := s.checkpoints.markDone(key); err != nil {
+				s.warn(fmt.Sprintf("Couldn't record %s in %s: %s", subdir, s.checkpoints.path, err))
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return stats, firstErr
+	}
+	sort.Strings(excludes)
+	rootStats, err := s.runRsync(ctx, append(args[:len(args):len(args)], excludes...), dirSource, dirTarget)
+	stats.add(rootStats)
+	if err != nil {
+		return stats, err
+	}
+	if s.Opts.DryRun || s.checkpoints == nil {
+		return stats, nil
+	}
+	if err := s.checkpoints.forget(dirSource, dirTarget); err != nil {
+		s.warn(fmt.Sprintf("Couldn't remove %s from %s: %s", dirSource, s.checkpoints.path, err))
+	}
+	return stats, nil
+}
+
+// escapeRsyncPattern escapes the wildcards of name, so that an rsync filter
+// pattern matches it literally.
+func escapeRsyncPattern(name string) string {
+	var escaped strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
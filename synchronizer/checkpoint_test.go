@@ -0,0 +1,296 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkpointVolume creates a volume dir with the subdirs a, b and c and a
+// top-level file.
+func checkpointVolume(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, child := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(dir, child), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "top.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// useCheckpoints sets the checkpoints of s to a new log, in a temporary dir,
+// holding keys.
+func useCheckpoints(t *testing.T, s *Synchronizer, keys ...string) {
+	t.Helper()
+	var err error
+	if s.checkpoints, err = loadCheckpointLog(filepath.Join(t.TempDir(), "checkpoints")); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := s.checkpoints.markDone(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// joined returns calls as the space-joined lines of fakeCalls.
+func joined(calls [][]string) []string {
+	lines := make([]string, 0, len(calls))
+	for _, call := range calls {
+		lines = append(lines, strings.Join(call[1:], " "))
+	}
+	return lines
+}
+
+// rsyncSources returns the source dir of every rsync of calls.
+func rsyncSources(calls []string) []string {
+	sources := make([]string, 0, len(calls))
+	for _, call := range calls {
+		args := strings.Fields(call)
+		sources = append(sources, args[len(args)-2])
+	}
+	return sources
+}
+
+func TestRsyncByChild(t *testing.T) {
+	s := testSynchronizer(t, Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 1})
+	calls := fakeCommand(t, "rsync", 0)
+	source, target := checkpointVolume(t), t.TempDir()
+	useCheckpoints(t, s, checkpointKey(source, target, "b"))
+
+	captureOutput(t, s, func() {
+		if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, target); err != nil {
+			t.Fatal(err)
+		}
+	})
+	got := fakeCalls(t, calls)
+	if sources, want := rsyncSources(got), []string{filepath.Join(source, "a"), filepath.Join(source, "c"), source}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("got rsyncs of %v, want %v", sources, want)
+	}
+	if want := "-a --exclude=/a/ --exclude=/b/ --exclude=/c/ --stats " + source + " " + target; got[len(got)-1] != want {
+		t.Errorf("got last rsync %q, want %q", got[len(got)-1], want)
+	}
+	if len(s.checkpoints.done) != 0 {
+		t.Errorf("subdirs of the rsynced volume not forgotten: %v", s.checkpoints.done)
+	}
+}
+
+func TestRsyncByChildEscapesExcludes(t *testing.T) {
+	s := testSynchronizer(t, Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 2})
+	calls := fakeCommand(t, "rsync", 0)
+	source := t.TempDir()
+	if err := os.Mkdir(filepath.Join(source, "logs[1]*"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	captureOutput(t, s, func() {
+		if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	got := fakeCalls(t, calls)
+	if last := strings.Fields(got[len(got)-1]); last[1] != `--exclude=/logs\[1]\*/` {
+		t.Errorf("got exclude %q", last[1])
+	}
+}
+
+func TestRsyncByChildFailure(t *testing.T) {
+	s := testSynchronizer(t, Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 1})
+	calls := fakeCommand(t, "rsync", 23)
+	source := checkpointVolume(t)
+	useCheckpoints(t, s)
+
+	captureOutput(t, s, func() {
+		if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, t.TempDir()); err == nil {
+			t.Error("got no error with a failed subdir")
+		}
+	})
+	if got := rsyncSources(fakeCalls(t, calls)); slices.Contains(got, source) {
+		t.Errorf("got rsyncs of %v, want the rest of the volume left after a failure", got)
+	}
+	if len(s.checkpoints.done) != 0 {
+		t.Errorf("failed subdirs recorded: %v", s.checkpoints.done)
+	}
+}
+
+func TestRsyncByChildCheckpointsPerTarget(t *testing.T) {
+	s, fake, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 1})
+	source, firstTarget, secondTarget := checkpointVolume(t), t.TempDir(), t.TempDir()
+	useCheckpoints(t, s)
+	fake.err = errors.New("exit status 23")
+	fake.failing = filepath.Join(source, "c")
+
+	if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, firstTarget); err == nil {
+		t.Fatal("got no error with a failed subdir")
+	}
+	for _, child := range []string{"a", "b"} {
+		if !s.checkpoints.isDone(checkpointKey(source, firstTarget, child)) {
+			t.Errorf("subdir %s rsynced to the first target not recorded", child)
+		}
+	}
+
+	fake.calls = nil
+	fake.failing = ""
+	fake.err = nil
+	if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, secondTarget); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(source, "a"), filepath.Join(source, "b"), filepath.Join(source, "c"), source}
+	if got := rsyncSources(joined(fake.calls)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got rsyncs of %v to the second target, want %v", got, want)
+	}
+	if !s.checkpoints.isDone(checkpointKey(source, firstTarget, "a")) {
+		t.Error("subdirs of the first target forgotten by the second one")
+	}
+}
+
+func TestLoadCheckpointLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints")
+	c, err := loadCheckpointLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := checkpointKey("/tmp/source-fs-1/pvc-1", "/tmp/target-fs-2/pvc-2", "data")
+	if err := c.markDone(key); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := loadCheckpointLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.isDone(key) {
+		t.Errorf("%q not reloaded", key)
+	}
+	if reloaded.isDone(checkpointKey("/tmp/source-fs-1/pvc-1", "/tmp/target-fs-3/pvc-2", "data")) {
+		t.Error("subdir done on a target considered done on another one")
+	}
+	if err := reloaded.forget("/tmp/source-fs-1/pvc-1", "/tmp/target-fs-2/pvc-2"); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err = loadCheckpointLog(path); err != nil || reloaded.isDone(key) {
+		t.Errorf("got %v, want the subdirs of the volume forgotten", err)
+	}
+}
+
+func TestCheckCheckpointArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want int
+	}{
+		{"default", Opts{IntraVolumeParallelism: 1}, exitOK},
+		{"checkpoint log", Opts{IntraVolumeParallelism: 1, CheckpointLog: "checkpoints"}, exitOK},
+		{"parallel", Opts{IntraVolumeParallelism: 4, CheckpointLog: "checkpoints"}, exitOK},
+		{"no parallelism", Opts{IntraVolumeParallelism: 0}, exitConfig},
+		{"checkpoint log and snapshots", Opts{IntraVolumeParallelism: 1, CheckpointLog: "checkpoints", Snapshots: true}, exitConfig},
+		{"parallel and sample files", Opts{IntraVolumeParallelism: 2, SampleFiles: 10}, exitConfig},
+		{"parallel and newer than start", Opts{IntraVolumeParallelism: 2, ExcludeNewerThanStart: true}, exitConfig},
+		{"sample files alone", Opts{IntraVolumeParallelism: 1, SampleFiles: 10}, exitOK},
+	}
+	for _, test := range tests {
+		if err := checkCheckpointArgs(&test.opts); ExitCode(err) != test.want {
+			t.Errorf("%s: got %v, want exit code %d", test.name, err, test.want)
+		}
+	}
+}
+
+// concurrentRunner records how many of its commands run at the same time,
+// each taking a little while.
+type concurrentRunner struct {
+	fakeRunner
+	mu      sync.Mutex
+	running int
+	most    int
+}
+
+func (r *concurrentRunner) Run(name string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	r.running++
+	r.most = max(r.most, r.running)
+	r.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return r.fakeRunner.Run(name, args...)
+}
+
+func TestRsyncByChildParallelism(t *testing.T) {
+	for _, parallelism := range []int{1, 2} {
+		s, _, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", IntraVolumeParallelism: parallelism})
+		fake := &concurrentRunner{}
+		s.Runner = fake
+		source := checkpointVolume(t)
+
+		if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if fake.most != parallelism {
+			t.Errorf("got %d rsyncs at the same time with --intraVolumeParallelism=%d, want %d", fake.most, parallelism, parallelism)
+		}
+		if len(fake.calls) != 4 {
+			t.Errorf("got %d rsyncs, want one per subdir and a last one", len(fake.calls))
+		}
+	}
+}
+
+// removingRunner fails the rsync of subdir after removing it, as when it is
+// deleted from the live volume during the copy.
+type removingRunner struct {
+	fakeRunner
+	subdir string
+}
+
+func (r *removingRunner) Run(name string, args ...string) ([]byte, error) {
+	output, err := r.fakeRunner.Run(name, args...)
+	if slices.Contains(args, r.subdir) {
+		os.RemoveAll(r.subdir)
+		return output, errors.New("exit status 23")
+	}
+	return output, err
+}
+
+func TestRsyncByChildRemovedSubdir(t *testing.T) {
+	s, _, logs := testFakeRunner(t, &Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 2})
+	source, target := checkpointVolume(t), t.TempDir()
+	fake := &removingRunner{subdir: filepath.Join(source, "b")}
+	s.Runner = fake
+
+	if _, err := s.rsyncByChild(context.Background(), []string{"-a"}, source, target); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rsync", "-a", "--exclude=/a/", "--exclude=/c/", "--stats", source, target}
+	if last := fake.calls[len(fake.calls)-1]; !reflect.DeepEqual(last, want) {
+		t.Errorf("got last rsync %q, want %q", last, want)
+	}
+	if !strings.Contains(logs.String(), "was removed while rsyncing it") {
+		t.Errorf("removal not logged, got logs:\n%s", logs)
+	}
+}
+
+func TestRsyncDirIntraVolumeParallelism(t *testing.T) {
+	s := testSynchronizer(t, Opts{RsyncBinary: "rsync", IntraVolumeParallelism: 2})
+	calls := fakeCommand(t, "rsync", 0)
+	source := checkpointVolume(t)
+
+	captureOutput(t, s, func() {
+		if _, err := s.rsyncDir(context.Background(), source+"/", t.TempDir()+"/", "-a", 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if got := fakeCalls(t, calls); len(got) != 4 {
+		t.Errorf("got rsyncs %q, want one per subdir and a last one", got)
+	}
+}
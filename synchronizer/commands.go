@@ -0,0 +1,83 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// secretURLPattern matches the password in the user info of a URL, e.g. of
+// an rsync daemon, keeping what precedes it.
+var secretURLPattern = regexp.MustCompile(`(://[^/@:\s]*:)[^/@\s]+@`)
+
+// CommandRunner runs the mount, umount, rsync and hook commands of a run.
+// Replacing it, with Synchronizer.Runner, lets tests check the arguments of
+// the commands without running them.
+type CommandRunner interface {
+	// Run runs the command name with args and returns its combined output.
+	Run(name string, args ...string) (output []byte, err error)
+}
+
+// execRunner runs commands with newCommand and env, so cancelled when ctx is
+// done, writing their output to output as it comes.
+type execRunner struct {
+	ctx    context.Context
+	env    []string
+	output io.Writer
+}
+
+func (r execRunner) Run(name string, args ...string) ([]byte, error) {
+	command := newCommand(r.ctx, r.env, name, args...)
+	var combined bytes.Buffer
+	writer := io.Writer(&combined)
+	if r.output != nil {
+		writer = io.MultiWriter(&combined, r.output)
+	}
+	command.Stdout = writer
+	command.Stderr = writer
+	err := command.Run()
+	return combined.Bytes(), err
+}
+
+// commandRunner returns Runner when set, or an execRunner of ctx whose output
+// is only returned.
+func (s *Synchronizer) commandRunner(ctx context.Context) CommandRunner {
+	if s.Runner == nil {
+		return execRunner{ctx: ctx, env: s.commandEnv()}
+	}
+	return s.Runner
+}
+
+// runCommand logs then runs the command name with args, with Runner when set
+// or execRunner otherwise, and returns its combined output. The output is
+// also written to output, when not nil, as it comes with execRunner and once
+// done with Runner.
+func (s *Synchronizer) runCommand(ctx context.Context, output io.Writer, name string, args ...string) ([]byte, error) {
+	s.printLine(redactCommand(name, args...))
+	if s.Runner == nil {
+		return execRunner{ctx: ctx, env: s.commandEnv(), output: output}.Run(name, args...)
+	}
+	combined, err := s.Runner.Run(name, args...)
+	if output != nil {
+		output.Write(combined)
+	}
+	return combined, err
+}
+
+// redactCommand formats the command name with args to be logged, masking like
+// redactEnv the KEY=VALUE arguments, and comma separated mount options, whose
+// key looks sensitive, as well as the passwords of URLs.
+func redactCommand(name string, args ...string) string {
+	words := make([]string, 0, len(args)+1)
+	words = append(words, name)
+	for _, arg := range args {
+		options := strings.Split(arg, ",")
+		for i, option := range options {
+			options[i] = redactEnv(option)
+		}
+		words = append(words, secretURLPattern.ReplaceAllString(strings.Join(options, ","), "${1}REDACTED@"))
+	}
+	return strings.Join(words, " ")
+}
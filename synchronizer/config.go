@@ -0,0 +1,55 @@
+package synchronizer
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// secretPattern matches option=value pairs whose value looks sensitive.
+var secretPattern = regexp.MustCompile(`(?i)((?:password|passwd|secret|token|key)[\w-]*=)[^\s,]+`)
+
+func redact(value string) string {
+	return secretPattern.ReplaceAllString(value, "${1}REDACTED")
+}
+
+// resolvedConfig returns the effective options, keyed by flag name, with
+// sensitive values redacted.
+func resolvedConfig(opts *Opts) map[string]interface{} {
+	config := make(map[string]interface{})
+	value := reflect.ValueOf(opts).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Tag.Get("long")
+		if name == "" {
+			continue
+		}
+		switch field := value.Field(i).Interface().(type) {
+		case string:
+			if name == "summaryWebhook" && field != "" {
+				config[name] = redactURL(field)
+			} else {
+				config[name] = redact(field)
+			}
+		case []string:
+			redacted := make([]string, 0, len(field))
+			for _, item := range field {
+				redacted = append(redacted, redact(item))
+			}
+			config[name] = redacted
+		default:
+			config[name] = field
+		}
+	}
+	return config
+}
+
+func (s *Synchronizer) printResolvedConfig(opts *Opts) error {
+	out, err := yaml.Marshal(resolvedConfig(opts))
+	if err != nil {
+		return configError("Couldn't marshal the configuration", err)
+	}
+	fmt.Fprint(s.output, string(out))
+	return nil
+}
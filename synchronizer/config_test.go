@@ -0,0 +1,76 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"-o tls,iam", "-o tls,iam"},
+		{"-o user=admin,password=hunter2,hard", "-o user=admin,password=REDACTED,hard"},
+		{"AWS_SECRET_ACCESS_KEY=abc", "AWS_SECRET_ACCESS_KEY=REDACTED"},
+		{"--token=abc --api-key=def", "--token=REDACTED --api-key=REDACTED"},
+	}
+	for _, test := range tests {
+		if got := redact(test.value); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestResolvedConfig(t *testing.T) {
+	config := resolvedConfig(&Opts{
+		MountArgs:        "-t nfs4 -o password=hunter2",
+		TargetEFSDNSName: []string{"fs-1.efs", "token=abc"},
+		SampleFiles:      4,
+	})
+	if got := config["mountArgs"]; got != "-t nfs4 -o password=REDACTED" {
+		t.Errorf("got mountArgs %q", got)
+	}
+	if got, want := config["targetEFSDNSName"], []string{"fs-1.efs", "token=REDACTED"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got targetEFSDNSName %q, want %q", got, want)
+	}
+	if config["sampleFiles"] != 4 || config["dryRun"] != false {
+		t.Errorf("got sampleFiles %v and dryRun %v", config["sampleFiles"], config["dryRun"])
+	}
+}
+
+func TestPrintResolvedConfig(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	logs := captureOutput(t, s, func() {
+		if err := s.printResolvedConfig(&Opts{MountArgs: "-o password=hunter2", SampleFiles: 4}); err != nil {
+			t.Error(err)
+		}
+	})
+	for _, want := range []string{"mountArgs: -o password=REDACTED\n", "sampleFiles: 4\n"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("got:\n%s\nwant %q", logs, want)
+		}
+	}
+	if strings.Contains(logs, "hunter2") {
+		t.Errorf("secret printed:\n%s", logs)
+	}
+}
+
+func TestDryRunCreateDirsWarns(t *testing.T) {
+	for _, dryRunCreateDirs := range []bool{false, true} {
+		args := []string{"--dryRun", "--printResolvedConfig"}
+		if dryRunCreateDirs {
+			args = append(args, "--dryRunCreateDirs")
+		}
+		logs := &bytes.Buffer{}
+		if err := (&Synchronizer{Opts: testRunOpts(t, args...), Logger: logs}).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(logs.String(), "WARN -  [DRY RUN] --dryRunCreateDirs is deprecated and ignored"); got != dryRunCreateDirs {
+			t.Errorf("with dryRunCreateDirs %t, got warning %t in:\n%s", dryRunCreateDirs, got, logs)
+		}
+	}
+}
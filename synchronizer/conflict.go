@@ -0,0 +1,141 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// recreateTimeout is how long a target pvc deleted by
+// --onImmutableConflict=recreate may take to be gone, e.g. while a pod still
+// mounts it.
+const recreateTimeout = 5 * time.Minute
+
+// checkConflictArgs refuses --onImmutableConflict=recreate, which deletes
+// target pvcs, unless it is confirmed by --force or rehearsed with --dryRun.
+func checkConflictArgs(opts *Opts) error {
+	if opts.OnImmutableConflict == "recreate" && !opts.Force && !opts.DryRun {
+		return configError("Refusing to recreate target pvcs", errors.New("--onImmutableConflict=recreate deletes the conflicting target pvcs and their volumes: run it with --dryRun first to review them, then pass --force"))
+	}
+	return nil
+}
+
+// volumeModeOf returns the volume mode of pvc, Filesystem when unset.
+func volumeModeOf(pvc v1.PersistentVolumeClaim) v1.PersistentVolumeMode {
+	if pvc.Spec.VolumeMode == nil {
+		return v1.PersistentVolumeFilesystem
+	}
+	return *pvc.Spec.VolumeMode
+}
+
+// accessModesOf returns the access modes of pvc, sorted and comma separated.
+func accessModesOf(pvc v1.PersistentVolumeClaim) string {
+	modes := make([]string, 0, len(pvc.Spec.AccessModes))
+	for _, mode := range pvc.Spec.AccessModes {
+		modes = append(modes, string(mode))
+	}
+	sort.Strings(modes)
+	return strings.Join(modes, ",")
+}
+
+// immutableDifferences lists the fields of targetPVC, immutable once the pvc
+// is created, that differ from sourcePVC. The storage class needs no check:
+// only the target pvcs of the target storage class are listed.
+func immutableDifferences(sourcePVC, targetPVC v1.PersistentVolumeClaim) []string {
+	differences := make([]string, 0)
+	if source, target := volumeModeOf(sourcePVC), volumeModeOf(targetPVC); source != target {
+		differences = append(differences, fmt.Sprintf("volumeMode %s instead of %s", target, source))
+	}
+	if source, target := accessModesOf(sourcePVC), accessModesOf(targetPVC); source != target {
+		differences = append(differences, fmt.Sprintf("accessModes %s instead of %s", target, source))
+	}
+	return differences
+}
+
+// resolveImmutableConflicts compares the pvcs that already existed on target
+// with their source and, for the ones differing in an immutable field, fails,
+// records them in target.conflicts so that their volume isn't rsynced, or
+// deletes them so that they are created again, as --onImmutableConflict says.
+func (s *Synchronizer) resolveImmutableConflicts(ctx context.Context, target *target, pvcsSource map[string]v1.PersistentVolumeClaim) error {
+	sourceIndexes := make([]string, 0, len(pvcsSource))
+	for sourceIndex := range pvcsSource {
+		sourceIndexes = append(sourceIndexes, sourceIndex)
+	}
+	sort.Strings(sourceIndexes)
+	for _, sourceIndex := range sourceIndexes {
+		targetIndex := s.nameMapping.target(sourceIndex)
+		targetPVC, ok := target.pvcs[targetIndex]
+		if !ok || target.created[targetIndex] {
+			continue
+		}
+		differences := immutableDifferences(pvcsSource[sourceIndex], targetPVC)
+		if len(differences) == 0 {
+			continue
+		}
+		conflict := fmt.Sprintf("pvc %s on %s has %s", targetIndex, target.context, strings.Join(differences, ", "))
+		switch s.Opts.OnImmutableConflict {
+		case "fail":
+			return clusterError("Immutable conflict on target pvc", errors.New(conflict))
+		case "recreate":
+			s.log("recreating " + conflict)
+			if err := s.recreateTargetPVC(ctx, target.client, targetPVC); err != nil {
+				return err
+			}
+			delete(target.pvcs, targetIndex)
+			target.recreated = append(target.recreated, targetIndex)
+		default:
+			s.warn("Skipping " + conflict)
+			target.conflicts[sourceIndex] = "immutable conflict: " + strings.Join(differences, ", ")
+		}
+	}
+	s.report.recreated(target.context, target.recreated)
+	return nil
+}
+
+// recreateTargetPVC deletes pvc and waits for it to be gone, so that
+// createMissingPVCs can create it again. With --dryRun the deletion is only
+// validated by the API server.
+func (s *Synchronizer) recreateTargetPVC(ctx context.Context, client kubernetes.Interface, pvc v1.PersistentVolumeClaim) error {
+	deleteOptions := metav1.DeleteOptions{}
+	if s.Opts.DryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	apiCtx, cancel := s.apiContext(ctx)
+	err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(apiCtx, pvc.Name, deleteOptions)
+	cancel()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return clusterError("Couldn't delete pvc "+pvc.Namespace+"/"+pvc.Name, err)
+	}
+	if s.Opts.DryRun {
+		return nil
+	}
+	deadline := time.Now().Add(recreateTimeout)
+	for {
+		apiCtx, cancel := s.apiContext(ctx)
+		_, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(apiCtx, pvc.Name, metav1.GetOptions{})
+		cancel()
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return clusterError("Couldn't get pvc "+pvc.Namespace+"/"+pvc.Name, err)
+		}
+		if time.Now().After(deadline) {
+			return clusterError("Couldn't recreate pvc "+pvc.Namespace+"/"+pvc.Name, fmt.Errorf("still terminating after %s, is a pod still using it?", recreateTimeout))
+		}
+		s.log("waiting for pvc " + pvc.Namespace + "/" + pvc.Name + " to be deleted...")
+		select {
+		case <-time.After(bindPollInterval):
+		case <-ctx.Done():
+			return clusterError("Stopped waiting for pvc "+pvc.Namespace+"/"+pvc.Name+" to be deleted", s.cancelled(ctx, ctx.Err()))
+		}
+	}
+}
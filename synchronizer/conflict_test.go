@@ -0,0 +1,167 @@
+package synchronizer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func withAccessModes(modes ...v1.PersistentVolumeAccessMode) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) { pvc.Spec.AccessModes = modes }
+}
+
+func withVolumeMode(mode v1.PersistentVolumeMode) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) { pvc.Spec.VolumeMode = &mode }
+}
+
+func TestCheckConflictArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want int
+	}{
+		{"skip", Opts{OnImmutableConflict: "skip"}, exitOK},
+		{"fail", Opts{OnImmutableConflict: "fail"}, exitOK},
+		{"recreate", Opts{OnImmutableConflict: "recreate"}, exitConfig},
+		{"recreate with force", Opts{OnImmutableConflict: "recreate", Force: true}, exitOK},
+		{"recreate in dry-run", Opts{OnImmutableConflict: "recreate", DryRun: true}, exitOK},
+	}
+	for _, test := range tests {
+		if err := checkConflictArgs(&test.opts); ExitCode(err) != test.want {
+			t.Errorf("%s: got %v, want exit code %d", test.name, err, test.want)
+		}
+	}
+}
+
+func TestImmutableDifferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		target *v1.PersistentVolumeClaim
+		want   []string
+	}{
+		{"same", testPVC("default", "data"), []string{}},
+		{"explicit filesystem mode", testPVC("default", "data", withVolumeMode(v1.PersistentVolumeFilesystem)), []string{}},
+		{"block mode", testPVC("default", "data", withVolumeMode(v1.PersistentVolumeBlock)), []string{"volumeMode Block instead of Filesystem"}},
+		{"access modes", testPVC("default", "data", withAccessModes(v1.ReadWriteOnce)), []string{"accessModes ReadWriteOnce instead of ReadWriteMany"}},
+		{
+			"both",
+			testPVC("default", "data", withVolumeMode(v1.PersistentVolumeBlock), withAccessModes(v1.ReadWriteOnce, v1.ReadOnlyMany)),
+			[]string{"volumeMode Block instead of Filesystem", "accessModes ReadOnlyMany,ReadWriteOnce instead of ReadWriteMany"},
+		},
+	}
+	for _, test := range tests {
+		if got := immutableDifferences(*testPVC("default", "data"), *test.target); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// conflictTarget returns a target whose pvcs are the ones of client, with
+// default/created created by this run.
+func conflictTarget(client *fake.Clientset, pvcs ...*v1.PersistentVolumeClaim) *target {
+	return &target{
+		context:   "target",
+		client:    client,
+		pvcs:      pvcMap(pvcs...),
+		created:   map[string]bool{"default/created": true},
+		conflicts: make(map[string]string),
+	}
+}
+
+func TestResolveImmutableConflicts(t *testing.T) {
+	pvcsSource := pvcMap(testPVC("default", "same"), testPVC("default", "conflicting"), testPVC("default", "created"))
+	targetPVCs := []*v1.PersistentVolumeClaim{
+		testPVC("default", "same"),
+		testPVC("default", "conflicting", withAccessModes(v1.ReadWriteOnce)),
+		testPVC("default", "created", withAccessModes(v1.ReadWriteOnce)),
+	}
+	tests := []struct {
+		mode          string
+		wantCode      int
+		wantConflicts []string
+		wantRecreated []string
+	}{
+		{"skip", exitOK, []string{"default/conflicting"}, nil},
+		{"fail", exitCluster, nil, nil},
+		{"recreate", exitOK, nil, []string{"default/conflicting"}},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			s, _, _ := testFakeRunner(t, &Opts{OnImmutableConflict: test.mode, Force: true})
+			s.report = &SyncReport{}
+			objects := make([]runtime.Object, 0, len(targetPVCs))
+			for _, pvc := range targetPVCs {
+				objects = append(objects, pvc)
+			}
+			client := fake.NewSimpleClientset(objects...)
+			target := conflictTarget(client, targetPVCs...)
+
+			err := s.resolveImmutableConflicts(context.Background(), target, pvcsSource)
+			if ExitCode(err) != test.wantCode {
+				t.Fatalf("got %v, want exit code %d", err, test.wantCode)
+			}
+			if len(target.conflicts) != len(test.wantConflicts) {
+				t.Errorf("got conflicts %v, want %v", target.conflicts, test.wantConflicts)
+			}
+			for _, conflict := range test.wantConflicts {
+				if target.conflicts[conflict] != "immutable conflict: accessModes ReadWriteOnce instead of ReadWriteMany" {
+					t.Errorf("got conflicts %v, want %s skipped", target.conflicts, conflict)
+				}
+			}
+			if !reflect.DeepEqual(target.recreated, test.wantRecreated) {
+				t.Errorf("got recreated %v, want %v", target.recreated, test.wantRecreated)
+			}
+			_, err = client.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "conflicting", metav1.GetOptions{})
+			if deleted := apierrors.IsNotFound(err); deleted != (test.mode == "recreate") {
+				t.Errorf("got conflicting pvc deleted %t, want %t", deleted, test.mode == "recreate")
+			}
+			if _, ok := target.pvcs["default/conflicting"]; ok == (test.mode == "recreate") {
+				t.Errorf("got conflicting pvc listed %t after %s", ok, test.mode)
+			}
+		})
+	}
+}
+
+func TestRecreateTargetPVCDryRun(t *testing.T) {
+	s, _, _ := testFakeRunner(t, &Opts{DryRun: true})
+	pvc := testPVC("default", "data")
+	client := fake.NewSimpleClientset(pvc)
+	var deleteOptions metav1.DeleteOptions
+	client.PrependReactor("delete", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteOptions = action.(k8stesting.DeleteAction).GetDeleteOptions()
+		return true, nil, nil
+	})
+
+	if err := s.recreateTargetPVC(context.Background(), client, *pvc); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{metav1.DryRunAll}; !reflect.DeepEqual(deleteOptions.DryRun, want) {
+		t.Errorf("got dry-run %v, want %v", deleteOptions.DryRun, want)
+	}
+}
+
+func TestRecreateTargetPVCStillTerminating(t *testing.T) {
+	s, _, _ := testFakeRunner(t, &Opts{})
+	pvc := testPVC("default", "data")
+	client := fake.NewSimpleClientset(pvc)
+	client.PrependReactor("delete", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+		// the pvc is only marked for deletion, as when a pod still mounts it
+		return true, nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	err := s.recreateTargetPVC(ctx, client, *pvc)
+	if ExitCode(err) != exitCluster || !strings.Contains(err.Error(), "Stopped waiting for pvc default/data to be deleted") {
+		t.Errorf("got %v, want the wait for the deletion stopped", err)
+	}
+}
@@ -0,0 +1,65 @@
+package synchronizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deletedPrefix starts the lines of rsync --itemize-changes listing the files
+// removed by --delete.
+const deletedPrefix = "*deleting"
+
+// checkDeleteArgs rejects the options that can't be combined with
+// --deleteExtraneous: with a file list rsync would delete from the target the
+// files left out of it.
+func checkDeleteArgs(opts *Opts) error {
+	if opts.DeleteAfter && !opts.DeleteExtraneous {
+		return configError("parse error", errors.New("--deleteAfter needs --deleteExtraneous"))
+	}
+	if opts.DeleteExtraneous && (opts.SampleFiles > 0 || opts.ExcludeNewerThanStart) {
+		return configError("parse error", errors.New("--deleteExtraneous can't be combined with --sampleFiles nor --excludeNewerThanStart"))
+	}
+	return nil
+}
+
+// deleteRehearsalMarker is the file recording that a dry-run with
+// --deleteExtraneous was done for the same source, targets and selection.
+func deleteRehearsalMarker(opts *Opts) string {
+	selection := []string{opts.SourceEKSContext, strings.Join(opts.TargetEKSContext, ","), opts.SourceStorageClass, strings.Join(opts.TargetStorageClass, ","), opts.PvcIncludeNamespaceRegex, opts.PvcIncludeNameRegex, opts.PvcExcludeNamespaceRegex, opts.PvcExcludeNameRegex, opts.PvcLabelSelector, opts.PvcFieldSelector, opts.HelmRelease}
+	sum := sha256.Sum256([]byte(strings.Join(selection, "\x00")))
+	return filepath.Join(os.TempDir(), "eks-volume-synchronizer-delete-"+hex.EncodeToString(sum[:8]))
+}
+
+// checkDeleteRehearsed refuses to delete files from the targets unless the
+// same run was done in dry-run first, to review the files to be deleted, or
+// --force is given.
+func (s *Synchronizer) checkDeleteRehearsed(opts *Opts) error {
+	if !opts.DeleteExtraneous || opts.DryRun || opts.Force {
+		return nil
+	}
+	marker := deleteRehearsalMarker(opts)
+	if _, err := os.Stat(marker); err != nil {
+		return configError("Refusing to delete files from the targets", errors.New("run the same command with --dryRun first to review the files to be deleted, or pass --force"))
+	}
+	s.log("found dry-run of --deleteExtraneous " + marker)
+	return nil
+}
+
+// markDeleteRehearsed records that the dry-run of --deleteExtraneous was done.
+func markDeleteRehearsed(opts *Opts) error {
+	return os.WriteFile(deleteRehearsalMarker(opts), []byte(time.Now().Format(time.RFC3339)+"\n"), 0o600)
+}
+
+// forgetDeleteRehearsal removes the marker once the deletions were done, so
+// that the next run is rehearsed again.
+func (s *Synchronizer) forgetDeleteRehearsal(opts *Opts) {
+	if err := os.Remove(deleteRehearsalMarker(opts)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.warn(fmt.Sprintf("Couldn't remove the dry-run marker of --deleteExtraneous: %s", err))
+	}
+}
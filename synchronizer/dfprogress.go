@@ -0,0 +1,120 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// dfProgress starts logging the --dfProgress estimates of the rsync from
+// source to target. A file system that can't be statfs-ed only disables it.
+func (s *Synchronizer) dfProgress(ctx context.Context, target *target, source *fileSystems) (func(), error) {
+	sourcePaths, err := source.mountPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetPaths, err := target.fileSystems.mountPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := s.startDfProgress(target.context, sourcePaths, targetPaths)
+	if err != nil {
+		s.warn(fmt.Sprintf("Couldn't estimate the progress of the rsync to %s: %s", target.context, err))
+		return func() {}, nil
+	}
+	return stop, nil
+}
+
+// usedBytes returns the bytes used on the file system mounted at path.
+func usedBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return (stat.Blocks - stat.Bfree) * uint64(stat.Bsize), nil
+}
+
+// totalUsedBytes sums usedBytes over the mount paths of a side.
+func totalUsedBytes(mountPaths []string) (uint64, error) {
+	var total uint64
+	for _, mountPath := range mountPaths {
+		used, err := usedBytes(mountPath)
+		if err != nil {
+			return 0, err
+		}
+		total += used
+	}
+	return total, nil
+}
+
+// dfAdded returns the bytes added to the target since it used before bytes,
+// none if it shrank.
+func dfAdded(before, now uint64) uint64 {
+	if now <= before {
+		return 0
+	}
+	return now - before
+}
+
+// dfPercent estimates the progress of a copy of expected bytes from the bytes
+// added to the target. It is capped at 100 since the target may grow for
+// other reasons.
+func dfPercent(added, expected uint64) int {
+	if expected == 0 {
+		return 0
+	}
+	percent := added * 100 / expected
+	if percent > 100 {
+		return 100
+	}
+	return int(percent)
+}
+
+// startDfProgress logs, every --dfProgressInterval until the returned function
+// is called, an estimate of the progress of the rsync to targetContext: the
+// bytes added to the target file systems against the bytes used on the
+// source ones. It is approximate, as the source may hold more than the
+// selected volumes and the target some of their data already, but works
+// with any rsync.
+func (s *Synchronizer) startDfProgress(targetContext string, sourcePaths, targetPaths []string) (func(), error) {
+	expected, err := totalUsedBytes(sourcePaths)
+	if err != nil {
+		return nil, err
+	}
+	before, err := totalUsedBytes(targetPaths)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(s.Opts.DfProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now, err := totalUsedBytes(targetPaths)
+				if err != nil {
+					s.warn(fmt.Sprintf("Couldn't estimate the progress of the rsync to %s: %s", targetContext, err))
+					continue
+				}
+				added := dfAdded(before, now)
+				s.log(fmt.Sprintf("df progress of the rsync to %s: ~%d%% (%s added of %s)", targetContext, dfPercent(added, expected), bytesQuantity(added), bytesQuantity(expected)))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+func bytesQuantity(bytes uint64) string {
+	return resource.NewQuantity(int64(bytes), resource.BinarySI).String()
+}
@@ -0,0 +1,87 @@
+package synchronizer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDfAdded(t *testing.T) {
+	tests := []struct {
+		before, now, want uint64
+	}{
+		{100, 150, 50},
+		{100, 100, 0},
+		{150, 100, 0},
+	}
+	for _, test := range tests {
+		if got := dfAdded(test.before, test.now); got != test.want {
+			t.Errorf("dfAdded(%d, %d): got %d, want %d", test.before, test.now, got, test.want)
+		}
+	}
+}
+
+func TestDfPercent(t *testing.T) {
+	tests := []struct {
+		added, expected uint64
+		want            int
+	}{
+		{0, 0, 0},
+		{10, 0, 0},
+		{0, 100, 0},
+		{50, 200, 25},
+		{200, 200, 100},
+		{300, 200, 100},
+	}
+	for _, test := range tests {
+		if got := dfPercent(test.added, test.expected); got != test.want {
+			t.Errorf("dfPercent(%d, %d): got %d, want %d", test.added, test.expected, got, test.want)
+		}
+	}
+}
+
+func TestBytesQuantity(t *testing.T) {
+	tests := []struct {
+		bytes uint64
+		want  string
+	}{
+		{0, "0"},
+		{1 << 30, "1Gi"},
+		{3 << 20, "3Mi"},
+	}
+	for _, test := range tests {
+		if got := bytesQuantity(test.bytes); got != test.want {
+			t.Errorf("bytesQuantity(%d): got %s, want %s", test.bytes, got, test.want)
+		}
+	}
+}
+
+func TestTotalUsedBytes(t *testing.T) {
+	if _, err := totalUsedBytes([]string{t.TempDir(), t.TempDir()}); err != nil {
+		t.Errorf("got %v, want the used bytes", err)
+	}
+	if _, err := totalUsedBytes([]string{t.TempDir() + "/missing"}); err == nil {
+		t.Error("got nil, want an error for a missing path")
+	}
+}
+
+func TestStartDfProgress(t *testing.T) {
+	s := testSynchronizer(t, Opts{DfProgressInterval: 10 * time.Millisecond})
+
+	logs := captureOutput(t, s, func() {
+		stop, err := s.startDfProgress("target", []string{t.TempDir()}, []string{t.TempDir()})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		stop()
+	})
+	if !strings.Contains(logs, "df progress of the rsync to target: ~") {
+		t.Errorf("progress not logged, got logs:\n%s", logs)
+	}
+
+	if _, err := s.startDfProgress("target", []string{t.TempDir() + "/missing"}, []string{t.TempDir()}); err == nil {
+		t.Error("got nil, want an error for a source that can't be statfs-ed")
+	}
+}
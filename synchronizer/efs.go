@@ -0,0 +1,59 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+)
+
+// resolveEFSDNSName returns the regional DNS name of fileSystemId
+// (fs-xxxxxxxx.efs.<region>.amazonaws.com), after checking with
+// DescribeMountTargets, using the credentials of awsProfile, that the file
+// system has a mount target in region.
+func (s *Synchronizer) resolveEFSDNSName(ctx context.Context, region, awsProfile, fileSystemId string) (string, error) {
+	if region == "" {
+		return "", configError("Couldn't resolve the EFS DNS name", errors.New("--region is needed to look up the file system, or pass the EFS DNS name or mount path"))
+	}
+	if fileSystemId == "" {
+		return "", configError("Couldn't resolve the EFS DNS name", errors.New("the storage class has no fileSystemId parameter"))
+	}
+	awsConfig, err := s.loadAWSConfig(ctx, region, awsProfile)
+	if err != nil {
+		return "", err
+	}
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	output, err := efs.NewFromConfig(awsConfig).DescribeMountTargets(apiCtx, &efs.DescribeMountTargetsInput{FileSystemId: aws.String(fileSystemId)})
+	if err != nil {
+		return "", clusterError(fmt.Sprintf("Couldn't describe the mount targets of %s in %s", fileSystemId, region), s.cancelled(ctx, err))
+	}
+	if len(output.MountTargets) == 0 {
+		return "", clusterError("Couldn't resolve the EFS DNS name", fmt.Errorf("file system %s has no mount target in %s", fileSystemId, region))
+	}
+	dnsName := fmt.Sprintf("%s.efs.%s.amazonaws.com", fileSystemId, region)
+	s.log(fmt.Sprintf("resolved the DNS name of %s: %s", fileSystemId, dnsName))
+	return dnsName, nil
+}
+
+// loadAWSConfig loads the AWS configuration of awsProfile, or the default
+// one, for region, returning an error when it has no credentials.
+func (s *Synchronizer) loadAWSConfig(ctx context.Context, region, awsProfile string) (aws.Config, error) {
+	configOptions := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if awsProfile != "" {
+		configOptions = append(configOptions, config.WithSharedConfigProfile(awsProfile))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, configOptions...)
+	if err != nil {
+		return aws.Config{}, configError("Couldn't load the AWS configuration", err)
+	}
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	if _, err := awsConfig.Credentials.Retrieve(apiCtx); err != nil {
+		return aws.Config{}, configError("No AWS credentials found", s.cancelled(ctx, err))
+	}
+	return awsConfig, nil
+}
@@ -0,0 +1,21 @@
+package synchronizer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveEFSDNSNameConfig(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	tests := []struct {
+		name, region, fileSystemId string
+	}{
+		{"no region", "", "fs-1"},
+		{"no file system", "eu-west-1", ""},
+	}
+	for _, test := range tests {
+		if _, err := s.resolveEFSDNSName(context.Background(), test.region, "", test.fileSystemId); ExitCode(err) != exitConfig {
+			t.Errorf("%s: got %v, want a config error", test.name, err)
+		}
+	}
+}
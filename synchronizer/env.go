@@ -0,0 +1,59 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// commandWaitDelay is how long a command is given to exit after being sent
+// SIGTERM, when the run is cancelled, before it is killed.
+const commandWaitDelay = 10 * time.Second
+
+// secretEnvPattern matches the names of environment variables whose value
+// shouldn't be logged.
+var secretEnvPattern = regexp.MustCompile(`(?i)password|passwd|secret|token|key|credential`)
+
+// checkEnv validates the --env values and logs them, masking secrets.
+func (s *Synchronizer) checkEnv(env []string) error {
+	for _, variable := range env {
+		name, _, found := strings.Cut(variable, "=")
+		if !found || name == "" {
+			return configError("parse error", fmt.Errorf("invalid --env %q, expected KEY=VALUE", redactEnv(variable)))
+		}
+		s.log("passing environment variable " + redactEnv(variable) + " to mount and rsync")
+	}
+	return nil
+}
+
+func redactEnv(variable string) string {
+	name, _, found := strings.Cut(variable, "=")
+	if found && secretEnvPattern.MatchString(name) {
+		return name + "=REDACTED"
+	}
+	return variable
+}
+
+// commandEnv is the environment of the mount and rsync commands: the one of
+// this process plus --env.
+func (s *Synchronizer) commandEnv() []string {
+	return append(os.Environ(), s.Opts.Env...)
+}
+
+// newCommand returns the mount or rsync command name, run with env, from
+// commandEnv. When ctx is done, on SIGINT, SIGTERM or --timeout, the command
+// is sent SIGTERM and killed if it hasn't exited after commandWaitDelay.
+func newCommand(ctx context.Context, env []string, name string, args ...string) *exec.Cmd {
+	command := exec.CommandContext(ctx, name, args...)
+	command.Env = env
+	command.Cancel = func() error {
+		return command.Process.Signal(syscall.SIGTERM)
+	}
+	command.WaitDelay = commandWaitDelay
+	return command
+}
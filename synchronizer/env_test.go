@@ -0,0 +1,44 @@
+package synchronizer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckEnv(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+
+	var err error
+	logs := captureOutput(t, s, func() {
+		err = s.checkEnv([]string{"HTTPS_PROXY=http://proxy", "AWS_SECRET_ACCESS_KEY=abc", "EMPTY="})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"HTTPS_PROXY=http://proxy", "AWS_SECRET_ACCESS_KEY=REDACTED", "EMPTY="} {
+		if !strings.Contains(logs, "passing environment variable "+want+" ") {
+			t.Errorf("%s not logged, got logs:\n%s", want, logs)
+		}
+	}
+	if strings.Contains(logs, "abc") {
+		t.Errorf("secret logged:\n%s", logs)
+	}
+	for _, invalid := range []string{"HTTPS_PROXY", "=value"} {
+		if err := s.checkEnv([]string{invalid}); ExitCode(err) != exitConfig {
+			t.Errorf("got %v for %q, want a config error", err, invalid)
+		}
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	s := testSynchronizer(t, Opts{Env: []string{"VOLUME_SYNC_TEST=1"}})
+	t.Setenv("VOLUME_SYNC_INHERITED", "1")
+
+	env := s.commandEnv()
+	for _, want := range []string{"VOLUME_SYNC_TEST=1", "VOLUME_SYNC_INHERITED=1"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("%s missing from %q", want, env)
+		}
+	}
+}
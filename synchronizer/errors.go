@@ -0,0 +1,98 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Exit codes of the synchronizer, for scripts.
+const (
+	exitOK      = 0
+	exitConfig  = 1 // invalid options or input files, failed pre-run command
+	exitCluster = 2 // Kubernetes API errors
+	exitMount   = 3 // EFS mount failures
+	exitRsync   = 4 // volumes that couldn't be rsynced
+)
+
+// exitError is an error ending the run with its exit code.
+type exitError struct {
+	code    int
+	message string
+	err     error
+}
+
+func (e *exitError) Error() string {
+	if e.message == "" {
+		return e.err.Error()
+	}
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func newExitError(code int, message string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, message: message, err: err}
+}
+
+// configError, clusterError, mountError and rsyncError describe err, when not
+// nil, with message and classify it for the exit code. They return nil for a
+// nil err.
+func configError(message string, err error) error {
+	return newExitError(exitConfig, message, err)
+}
+
+func clusterError(message string, err error) error {
+	return newExitError(exitCluster, message, err)
+}
+
+func mountError(message string, err error) error {
+	return newExitError(exitMount, message, err)
+}
+
+func rsyncError(message string, err error) error {
+	return newExitError(exitRsync, message, err)
+}
+
+// ExitCode returns the exit code of the run ending with err. Errors that
+// weren't classified are configuration errors.
+func ExitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitConfig
+}
+
+// LogError prints the error ending the run, with a remediation hint when one
+// is known.
+func (s *Synchronizer) LogError(err error) {
+	s.prepare()
+	currentTime := time.Now()
+	s.printLine(currentTime.Format("2006-01-02T15:04:05.00Z07:00") + " - ERROR - " + withHint(err).Error())
+}
+
+// cancelled explains that err comes from the run being cancelled, when ctx
+// is done, e.g. because --timeout was exceeded, or from a Kubernetes API call
+// exceeding --apiTimeout while the run goes on.
+func (s *Synchronizer) cancelled(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w (--apiTimeout of %s exceeded)", err, s.Opts.APITimeout)
+		}
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w (--timeout of %s exceeded)", err, s.Opts.Timeout)
+	}
+	return fmt.Errorf("%w (run cancelled)", err)
+}
@@ -0,0 +1,59 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCancelled(t *testing.T) {
+	s := testSynchronizer(t, Opts{APITimeout: 30 * time.Second, Timeout: 2 * time.Hour})
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	failure := errors.New("connection refused")
+	apiTimeout := fmt.Errorf("get pvcs: %w", context.DeadlineExceeded)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"running", context.Background(), failure, "connection refused"},
+		{"api call timeout", context.Background(), apiTimeout, "get pvcs: context deadline exceeded (--apiTimeout of 30s exceeded)"},
+		{"run timeout", expiredCtx, failure, "connection refused (--timeout of 2h0m0s exceeded)"},
+		{"run cancelled", cancelledCtx, failure, "connection refused (run cancelled)"},
+	}
+	for _, test := range tests {
+		got := s.cancelled(test.ctx, test.err)
+		if got.Error() != test.want || !errors.Is(got, test.err) {
+			t.Errorf("%s: got %q, want %q wrapping the error", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExitCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("unclassified"), exitConfig},
+		{configError("parse error", errors.New("bad flag")), exitConfig},
+		{clusterError("Couldn't list pvcs", errors.New("forbidden")), exitCluster},
+		{fmt.Errorf("wrapped: %w", mountError("Couldn't mount", errors.New("timed out"))), exitMount},
+		{rsyncError("Couldn't rsync 1 volumes", errors.New("default/data")), exitRsync},
+	}
+	for _, test := range tests {
+		if got := ExitCode(test.err); got != test.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+	if clusterError("message", nil) != nil {
+		t.Error("got an error for no error")
+	}
+}
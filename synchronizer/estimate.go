@@ -0,0 +1,120 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/api/core/v1"
+)
+
+// estimate runs rsync --dry-run --stats for the volume of every source pvc
+// against each target and prints how many bytes would be transferred, by
+// namespace and in total. A volume without a bound target pvc yet is
+// compared to an empty dir, as it would be copied in full.
+func (s *Synchronizer) estimate(ctx context.Context, sourceFileSystems *fileSystems, targets []*target, pvcsSource map[string]v1.PersistentVolumeClaim, rsyncArgs string) error {
+	empty, err := os.MkdirTemp("", "eks-volume-synchronizer-estimate-")
+	if err != nil {
+		return configError("Couldn't create an empty dir to estimate against", err)
+	}
+	defer os.Remove(empty)
+
+	sourceIndexes := make([]string, 0, len(pvcsSource))
+	for sourceIndex := range pvcsSource {
+		sourceIndexes = append(sourceIndexes, sourceIndex)
+	}
+	sort.Strings(sourceIndexes)
+
+	for _, target := range targets {
+		if s.Opts.StorageClassFromPV {
+			if err := target.fileSystems.resolveVolumes(ctx, target.client, target.pvcs); err != nil {
+				return err
+			}
+		}
+		byNamespace := make(map[string]*rsyncStats)
+		var total rsyncStats
+		for _, sourceIndex := range sourceIndexes {
+			sourcePVC := pvcsSource[sourceIndex]
+			if isBlockVolume(sourcePVC) || sourcePVC.Spec.VolumeName == "" {
+				s.log("not estimating pvc, no volume to rsync file by file: " + sourceIndex)
+				continue
+			}
+			dirSource, err := sourceFileSystems.dir(ctx, sourcePVC.Spec.VolumeName)
+			if err != nil {
+				return err
+			}
+			dirTarget, err := s.estimateTargetDir(ctx, target, sourceIndex, empty)
+			if err != nil {
+				return err
+			}
+			stats, err := s.rsyncDryRunStats(ctx, rsyncArgs, dirSource+string(os.PathSeparator), dirTarget+string(os.PathSeparator))
+			if err != nil {
+				return rsyncError("Couldn't estimate "+sourceIndex, err)
+			}
+			s.log(fmt.Sprintf("%s would transfer %s in %d out of %d files to %s", sourceIndex, bytesQuantity(uint64(stats.transferredBytes)), stats.transferredFiles, stats.files, target.context))
+			if byNamespace[sourcePVC.Namespace] == nil {
+				byNamespace[sourcePVC.Namespace] = &rsyncStats{}
+			}
+			byNamespace[sourcePVC.Namespace].add(stats)
+			total.add(stats)
+		}
+		s.printEstimate(target.context, byNamespace, total)
+	}
+	return nil
+}
+
+// estimateTargetDir returns the dir the volume of the source pvc would be
+// rsynced to on target, or empty when there is none yet. With --snapshots it
+// is the latest snapshot, which the next one is hard-linked to.
+func (s *Synchronizer) estimateTargetDir(ctx context.Context, target *target, sourceIndex, empty string) (string, error) {
+	targetPVC, ok := target.pvcs[s.nameMapping.target(sourceIndex)]
+	if !ok || targetPVC.Spec.VolumeName == "" {
+		return empty, nil
+	}
+	dirTarget, err := target.fileSystems.dir(ctx, targetPVC.Spec.VolumeName)
+	if err != nil {
+		return "", err
+	}
+	if s.Opts.Snapshots {
+		dirTarget = previousSnapshot(dirTarget)
+	}
+	if dirTarget == "" {
+		return empty, nil
+	}
+	if _, err := os.Stat(dirTarget); os.IsNotExist(err) {
+		return empty, nil
+	}
+	return filepath.Clean(dirTarget), nil
+}
+
+// rsyncDryRunStats runs rsync --dry-run --stats from the dir from to the dir
+// to and returns its stats, logging its output only when it fails.
+func (s *Synchronizer) rsyncDryRunStats(ctx context.Context, rsyncArgs, from, to string) (rsyncStats, error) {
+	args := append(splitArgs(rsyncArgs), "--dry-run", "--stats", from, to)
+	tail := s.newOutputTail("rsync "+from+": ", false, rsyncOutputTailLines)
+	if _, err := s.runCommand(ctx, tail, s.Opts.RsyncBinary, args...); err != nil {
+		if tail.String() != "" {
+			err = fmt.Errorf("%w, last lines of rsync's output:\n%s", err, tail.String())
+		}
+		return rsyncStats{}, s.cancelled(ctx, err)
+	}
+	return tail.rsyncStats(), nil
+}
+
+// printEstimate prints the bytes that would be transferred to the target
+// context, by namespace then in total.
+func (s *Synchronizer) printEstimate(context string, byNamespace map[string]*rsyncStats, total rsyncStats) {
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	s.printLine(fmt.Sprintf("estimate of the data to transfer to %s:", context))
+	for _, namespace := range namespaces {
+		stats := byNamespace[namespace]
+		s.printLine(fmt.Sprintf("  %s: %s (%d bytes) in %d out of %d files", namespace, bytesQuantity(uint64(stats.transferredBytes)), stats.transferredBytes, stats.transferredFiles, stats.files))
+	}
+	s.printLine(fmt.Sprintf("  total: %s (%d bytes) in %d out of %d files", bytesQuantity(uint64(total.transferredBytes)), total.transferredBytes, total.transferredFiles, total.files))
+}
@@ -0,0 +1,60 @@
+package synchronizer
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrintEstimate(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+
+	logs := captureOutput(t, s, func() {
+		s.printEstimate("target", map[string]*rsyncStats{
+			"web":     {files: 2, transferredFiles: 2, transferredBytes: 1 << 20},
+			"default": {files: 1, transferredFiles: 1, transferredBytes: 1024},
+		}, rsyncStats{files: 3, transferredFiles: 3, transferredBytes: 1<<20 + 1024})
+	})
+	want := "estimate of the data to transfer to target:\n" +
+		"  default: 1Ki (1024 bytes) in 1 out of 1 files\n" +
+		"  web: 1Mi (1048576 bytes) in 2 out of 2 files\n" +
+		"  total: 1025Ki (1049600 bytes) in 3 out of 3 files\n"
+	if logs != want {
+		t.Errorf("got:\n%s\nwant:\n%s", logs, want)
+	}
+}
+
+func TestRunEstimate(t *testing.T) {
+	a, b, c := testPVC("default", "a", withStorageClass("efs-sc")), testPVC("default", "b", withStorageClass("efs-sc")), testPVC("web", "c", withStorageClass("efs-sc"))
+	source, target := testClusters(a, b, c)
+	calls := fakeRsync(t, "Number of files: 10 (reg: 8, dir: 2)\nNumber of regular files transferred: 4\nTotal transferred file size: 1,024 bytes\n", "", 0)
+
+	logs, err := runSynchronizer(context.Background(), t, testRunOpts(t, "--estimate", "--pvcIncludeNamespaceRegex=^(default|web)$"), source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rsyncedFrom(t, calls, "/tmp/source-fs-test-source/pv-a/"); got != 1 {
+		t.Errorf("got %d rsyncs of a volume, want 1", got)
+	}
+	for _, call := range fakeCalls(t, calls) {
+		args := strings.Fields(call)
+		if !slices.Contains(args, "--help") && !(slices.Contains(args, "--dry-run") && slices.Contains(args, "--stats")) {
+			t.Errorf("got %q, want a rsync --dry-run --stats", call)
+		}
+	}
+	for _, want := range []string{"  default: 2Ki (2048 bytes) in 8 out of 20 files", "  web: 1Ki (1024 bytes) in 4 out of 10 files", "  total: 3Ki (3072 bytes) in 12 out of 30 files"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("%q not printed, got logs:\n%s", want, logs)
+		}
+	}
+	pvcs, err := target.CoreV1().PersistentVolumeClaims("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs.Items) != 0 {
+		t.Errorf("got %d target pvcs created, want none", len(pvcs.Items))
+	}
+}
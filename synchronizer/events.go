@@ -0,0 +1,33 @@
+package synchronizer
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const eventSource = "eks-volume-synchronizer"
+
+// newEventRecorder records Events on the cluster of clientset and returns a
+// function stopping it. Events are sent in the background, on a best effort
+// basis.
+func newEventRecorder(clientset kubernetes.Interface) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster(record.WithContext(context.Background()))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventSource})
+	return recorder, broadcaster.Shutdown
+}
+
+// emitEvent records an Event about object, unless events are disabled
+// (recorder is nil) or in dry-run.
+func (s *Synchronizer) emitEvent(recorder record.EventRecorder, object runtime.Object, eventType, reason, message string) {
+	if recorder == nil || s.Opts.DryRun {
+		return
+	}
+	recorder.Event(object, eventType, reason, message)
+}
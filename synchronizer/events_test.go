@@ -0,0 +1,44 @@
+package synchronizer
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEmitEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want int
+	}{
+		{"recorded", Opts{}, 1},
+		{"dry-run", Opts{DryRun: true}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, test.opts)
+			recorder := record.NewFakeRecorder(1)
+			s.emitEvent(recorder, testPVC("default", "data"), v1.EventTypeWarning, "VolumeSyncFailed", "rsync failed")
+			if got := len(recorder.Events); got != test.want {
+				t.Errorf("got %d events, want %d", got, test.want)
+			}
+		})
+	}
+	testSynchronizer(t, Opts{}).emitEvent(nil, testPVC("default", "data"), v1.EventTypeWarning, "VolumeSyncFailed", "rsync failed")
+}
+
+func TestCreateVPCEvent(t *testing.T) {
+	s := testSynchronizer(t, Opts{SourceEKSContext: "source", Quiet: true})
+	recorder := record.NewFakeRecorder(1)
+
+	if _, err := s.createVPC(context.Background(), fake.NewSimpleClientset(), recorder, "efs-target", false, "default/data", *testPVC("default", "data", withStorageClass("efs-sc"))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-recorder.Events, "Normal VolumeSyncCreated Created from pvc default/data of source"; got != want {
+		t.Errorf("got event %q, want %q", got, want)
+	}
+}
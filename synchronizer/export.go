@@ -0,0 +1,43 @@
+package synchronizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// exportManifests writes the manifest of the target pvc of every source pvc
+// to dir/<namespace>/<name>.yaml, without the fields set by the cluster, so
+// that they can be applied or committed as they are.
+func (s *Synchronizer) exportManifests(dir, storageClass string, stripBetaAnnotation bool, pvcs map[string]v1.PersistentVolumeClaim) error {
+	for _, sourceIndex := range fairOrder(pvcs) {
+		pvc, err := s.newTargetPVC(storageClass, stripBetaAnnotation, sourceIndex, pvcs[sourceIndex])
+		if err != nil {
+			return err
+		}
+		pvc.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"}
+		pvc.ObjectMeta.CreationTimestamp = metav1.Time{}
+		pvc.ObjectMeta.ManagedFields = nil
+		delete(pvc.ObjectMeta.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		pvc.Status = v1.PersistentVolumeClaimStatus{}
+
+		out, err := yaml.Marshal(pvc)
+		if err != nil {
+			return configError("Couldn't export the manifest of pvc "+sourceIndex, err)
+		}
+		path := filepath.Join(dir, pvc.ObjectMeta.Namespace, pvc.ObjectMeta.Name+".yaml")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return configError("Couldn't export the manifest of pvc "+sourceIndex, err)
+		}
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return configError("Couldn't export the manifest of pvc "+sourceIndex, err)
+		}
+		s.log(fmt.Sprintf("exported pvc %s to %s", sourceIndex, path))
+	}
+	s.log(fmt.Sprintf("%d pvc manifests exported to %s", len(pvcs), dir))
+	return nil
+}
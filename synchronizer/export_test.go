@@ -0,0 +1,52 @@
+package synchronizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestExportManifests(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	source := testPVC("apps", "data", withStorageClass("efs-sc"))
+	source.UID = "0b6e1c39-5d5e-4a65-9f0c-3d6b1f1f0e11"
+	source.ResourceVersion = "12345"
+	source.CreationTimestamp = metav1.Now()
+	source.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+	source.Annotations["kubectl.kubernetes.io/last-applied-configuration"] = "{}"
+	source.Annotations["pv.kubernetes.io/bind-completed"] = "yes"
+	source.Annotations["team"] = "shop"
+	dir := t.TempDir()
+
+	if err := s.exportManifests(dir, "efs-target", false, pvcMap(source)); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "apps", "data.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pvc v1.PersistentVolumeClaim
+	if err := yaml.Unmarshal(content, &pvc); err != nil {
+		t.Fatal(err)
+	}
+	if pvc.APIVersion != "v1" || pvc.Kind != "PersistentVolumeClaim" {
+		t.Errorf("got %s %s, want v1 PersistentVolumeClaim", pvc.APIVersion, pvc.Kind)
+	}
+	if pvc.UID != "" || pvc.ResourceVersion != "" || !pvc.CreationTimestamp.IsZero() || pvc.ManagedFields != nil {
+		t.Errorf("fields set by the cluster kept: %+v", pvc.ObjectMeta)
+	}
+	if want := map[string]string{"team": "shop"}; len(pvc.Annotations) != 1 || pvc.Annotations["team"] != "shop" {
+		t.Errorf("got annotations %v, want %v", pvc.Annotations, want)
+	}
+	if pvc.Spec.VolumeName != "" || *pvc.Spec.StorageClassName != "efs-target" || pvc.Status.Phase != "" {
+		t.Errorf("got spec %+v and status %+v, want an unbound pvc of efs-target", pvc.Spec, pvc.Status)
+	}
+	if strings.Contains(string(content), "phase:") {
+		t.Errorf("status exported:\n%s", content)
+	}
+}
@@ -0,0 +1,290 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// unmountTimeout bounds every umount of unmountAll, which runs once the run
+// is over, possibly cancelled, so that a hung NFS server doesn't block exiting.
+var unmountTimeout = time.Minute
+
+// fileSystems tracks the EFS file systems holding the volumes of one side of
+// the synchronization. By default every volume lives in the file system of the
+// storage class; with --storageClassFromPV each volume is looked up from its PV.
+// When mountPath is set the file system is already mounted there. The
+// mounts are recorded in s.
+type fileSystems struct {
+	s            *Synchronizer
+	prefix       string
+	efsDNSName   string
+	mountPath    string
+	readOnly     bool
+	fileSystemId string
+	volumes      map[string]efsVolume
+}
+
+// efsVolume is where a PV stores its data: a file system and, for statically
+// provisioned PVs, a path inside it.
+type efsVolume struct {
+	fileSystemId string
+	path         string
+}
+
+func (s *Synchronizer) newFileSystems(prefix, efsDNSName, mountPath, fileSystemId string) (*fileSystems, error) {
+	if mountPath != "" {
+		isMountPoint, err := isMountPoint(mountPath)
+		if err != nil {
+			return nil, mountError("Couldn't check mount path "+mountPath, err)
+		}
+		if !isMountPoint {
+			return nil, mountError("Invalid mount path", fmt.Errorf("%s isn't a mount point", mountPath))
+		}
+		s.log(fmt.Sprintf("using EFS already mounted at %s", mountPath))
+	}
+	return &fileSystems{
+		s:            s,
+		prefix:       prefix,
+		efsDNSName:   efsDNSName,
+		mountPath:    mountPath,
+		fileSystemId: fileSystemId,
+		volumes:      make(map[string]efsVolume),
+	}, nil
+}
+
+// resolveVolumes reads the PV of every bound pvc to find which file system
+// actually holds it.
+func (f *fileSystems) resolveVolumes(ctx context.Context, clientset kubernetes.Interface, pvcs map[string]v1.PersistentVolumeClaim) error {
+	for index, pvc := range pvcs {
+		volumeName := pvc.Spec.VolumeName
+		if volumeName == "" {
+			continue
+		}
+		if _, ok := f.volumes[volumeName]; ok {
+			continue
+		}
+		apiCtx, cancel := f.s.apiContext(ctx)
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(apiCtx, volumeName, metav1.GetOptions{})
+		cancel()
+		if apierrors.IsNotFound(err) {
+			f.s.log(fmt.Sprintf("pv %s of pvc %s doesn't exist anymore", volumeName, index))
+			continue
+		}
+		if err != nil {
+			return clusterError(fmt.Sprintf("Couldn't get pv %s of pvc %s", volumeName, index), f.s.cancelled(ctx, err))
+		}
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != efsProvisioner {
+			f.s.log(fmt.Sprintf("pv %s of pvc %s isn't an EFS CSI volume, assuming file system %s", volumeName, index, f.fileSystemId))
+			continue
+		}
+		f.volumes[volumeName] = parseVolumeHandle(pv.Spec.CSI.VolumeHandle)
+	}
+	return nil
+}
+
+// parseVolumeHandle parses an EFS CSI volume handle, which has the form
+// [FileSystemId]:[Subpath]:[AccessPointId].
+func parseVolumeHandle(volumeHandle string) efsVolume {
+	parts := strings.SplitN(volumeHandle, ":", 3)
+	volume := efsVolume{fileSystemId: parts[0]}
+	if len(parts) > 1 {
+		volume.path = parts[1]
+	}
+	return volume
+}
+
+// fileSystemIds returns the distinct file systems of the volumes.
+func (f *fileSystems) fileSystemIds() []string {
+	ids := []string{f.fileSystemId}
+	seen := map[string]bool{f.fileSystemId: true}
+	for _, volume := range f.volumes {
+		if !seen[volume.fileSystemId] {
+			seen[volume.fileSystemId] = true
+			ids = append(ids, volume.fileSystemId)
+		}
+	}
+	return ids
+}
+
+// mountAll mounts every file system holding one of the volumes.
+func (f *fileSystems) mountAll(ctx context.Context) error {
+	for _, fileSystemId := range f.fileSystemIds() {
+		if _, err := f.mount(ctx, fileSystemId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fileSystems) mount(ctx context.Context, fileSystemId string) (string, error) {
+	if f.mountPath != "" {
+		if fileSystemId != f.fileSystemId {
+			return "", mountError("Couldn't mount "+fileSystemId, fmt.Errorf("volumes span several file systems but only %s is mounted at %s", f.fileSystemId, f.mountPath))
+		}
+		return f.mountPath, nil
+	}
+	mountPath := fmt.Sprintf("/tmp/%s%s", f.prefix, fileSystemId)
+	if !f.s.mounted[mountPath] {
+		dnsName := f.efsDNSName
+		if fileSystemId != f.fileSystemId {
+			var err error
+			dnsName, err = efsDNSNameFor(f.efsDNSName, fileSystemId)
+			if err != nil {
+				return "", mountError("Couldn't find the DNS name of file system "+fileSystemId, err)
+			}
+		}
+		mountArgs := f.s.Opts.MountArgs
+		if f.readOnly {
+			mountArgs += " -o ro"
+		}
+		if _, err := f.s.mountEFS(ctx, f.prefix, fileSystemId, dnsName, mountArgs); err != nil {
+			return "", err
+		}
+		f.s.mounted[mountPath] = true
+	}
+	return mountPath, nil
+}
+
+// mountPaths returns where every file system holding one of the volumes is
+// mounted, mounting it if needed.
+func (f *fileSystems) mountPaths(ctx context.Context) ([]string, error) {
+	mountPaths := make([]string, 0)
+	for _, fileSystemId := range f.fileSystemIds() {
+		mountPath, err := f.mount(ctx, fileSystemId)
+		if err != nil {
+			return nil, err
+		}
+		mountPaths = append(mountPaths, mountPath)
+	}
+	return mountPaths, nil
+}
+
+// checkDifferentFileSystems returns an error when source and target share a
+// file system, by DNS name, mount path or file system id, since rsync would
+// then copy the data onto itself.
+func checkDifferentFileSystems(source, target *fileSystems) error {
+	same := ""
+	switch {
+	case source.efsDNSName != "" && source.efsDNSName == target.efsDNSName:
+		same = "EFS " + source.efsDNSName
+	case source.mountPath != "" && filepath.Clean(source.mountPath) == filepath.Clean(target.mountPath):
+		same = "mount path " + source.mountPath
+	default:
+		sourceIds := make(map[string]bool)
+		for _, fileSystemId := range source.fileSystemIds() {
+			sourceIds[fileSystemId] = fileSystemId != ""
+		}
+		for _, fileSystemId := range target.fileSystemIds() {
+			if sourceIds[fileSystemId] {
+				same = "file system " + fileSystemId
+				break
+			}
+		}
+	}
+	if same == "" {
+		return nil
+	}
+	return configError("Source and target are the same file system", fmt.Errorf("both use %s, pass --allowSameFilesystem to copy between volumes of a single file system", same))
+}
+
+// unmountAll unmounts the file systems mounted by this run and removes their
+// mount points, giving each umount unmountTimeout. It only warns on failures,
+// so that it can clean up after any error.
+func (s *Synchronizer) unmountAll() {
+	mountPaths := make([]string, 0, len(s.mounted))
+	for mountPath := range s.mounted {
+		mountPaths = append(mountPaths, mountPath)
+	}
+	sort.Strings(mountPaths)
+	for _, mountPath := range mountPaths {
+		s.log("unmounting " + mountPath + "...")
+		ctx, cancel := context.WithTimeout(context.Background(), unmountTimeout)
+		output, err := s.runCommand(ctx, nil, "umount", mountPath)
+		cancel()
+		if err != nil {
+			s.warn(fmt.Sprintf("Couldn't unmount %s: %s: %s", mountPath, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		delete(s.mounted, mountPath)
+		if err := os.Remove(mountPath); err != nil {
+			s.warn(fmt.Sprintf("Couldn't remove mount point %s: %s", mountPath, err))
+		}
+	}
+}
+
+// checkMarker returns an error unless the file marker, relative to the root
+// of the file system, exists on every mounted file system, to make sure the
+// intended EFS is mounted.
+func (f *fileSystems) checkMarker(ctx context.Context, marker string) error {
+	for _, fileSystemId := range f.fileSystemIds() {
+		mountPath, err := f.mount(ctx, fileSystemId)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(mountPath, marker)
+		if _, err := os.Stat(path); err != nil {
+			return mountError(fmt.Sprintf("Marker file %s not found, is %s the intended file system?", path, fileSystemId), err)
+		}
+		f.s.log("found marker file " + path)
+	}
+	return nil
+}
+
+// dir returns the directory holding the data of the volume.
+func (f *fileSystems) dir(ctx context.Context, volumeName string) (string, error) {
+	fileSystemId, path := f.fileSystemId, volumeName
+	if volume, ok := f.volumes[volumeName]; ok {
+		fileSystemId = volume.fileSystemId
+		if volume.path != "" && volume.path != "/" {
+			path = volume.path
+		}
+	}
+	mountPath, err := f.mount(ctx, fileSystemId)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(mountPath, path), nil
+}
+
+// isMountPoint reports whether path is the root of a mounted file system,
+// that is whether it lives on another device than its parent.
+func isMountPoint(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s isn't a directory", path)
+	}
+	parentInfo, err := os.Stat(filepath.Join(path, ".."))
+	if err != nil {
+		return false, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	parentStat, parentOk := parentInfo.Sys().(*syscall.Stat_t)
+	if !ok || !parentOk {
+		return false, fmt.Errorf("can't stat %s on this platform", path)
+	}
+	return stat.Dev != parentStat.Dev || stat.Ino == parentStat.Ino, nil
+}
+
+// efsDNSNameFor derives the DNS name of fileSystemId from the DNS name of
+// another file system of the same region (fs-xxxxxxxx.efs.<region>.amazonaws.com).
+func efsDNSNameFor(efsDNSName, fileSystemId string) (string, error) {
+	label, domain, found := strings.Cut(efsDNSName, ".")
+	if !found || !strings.HasPrefix(label, "fs-") {
+		return "", fmt.Errorf("%s isn't an EFS DNS name (fs-xxxxxxxx.efs.<region>.amazonaws.com)", efsDNSName)
+	}
+	return fileSystemId + "." + domain, nil
+}
@@ -0,0 +1,238 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseVolumeHandle(t *testing.T) {
+	tests := []struct {
+		volumeHandle string
+		want         efsVolume
+	}{
+		{"fs-1", efsVolume{fileSystemId: "fs-1"}},
+		{"fs-1:/data", efsVolume{fileSystemId: "fs-1", path: "/data"}},
+		{"fs-1::fsap-1", efsVolume{fileSystemId: "fs-1"}},
+		{"fs-1:/data:fsap-1", efsVolume{fileSystemId: "fs-1", path: "/data"}},
+	}
+	for _, test := range tests {
+		if got := parseVolumeHandle(test.volumeHandle); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.volumeHandle, got, test.want)
+		}
+	}
+}
+
+func TestEFSDNSNameFor(t *testing.T) {
+	got, err := efsDNSNameFor("fs-1.efs.eu-west-1.amazonaws.com", "fs-2")
+	if want := "fs-2.efs.eu-west-1.amazonaws.com"; err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+	if _, err := efsDNSNameFor("nfs.example.com", "fs-2"); err == nil {
+		t.Error("got no error for a DNS name that isn't EFS's")
+	}
+}
+
+// efsPV returns a pv of the EFS CSI driver with volumeHandle.
+func efsPV(name, volumeHandle string) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: efsProvisioner, VolumeHandle: volumeHandle},
+			},
+		},
+	}
+}
+
+func TestResolveVolumes(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	nfs := &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"}}
+	client := fake.NewSimpleClientset(efsPV("pv-same", "fs-1::fsap-1"), efsPV("pv-other", "fs-2:/static"), nfs)
+	pvcs := map[string]v1.PersistentVolumeClaim{
+		"default/same":    *testPVC("default", "same"),
+		"default/other":   *testPVC("default", "other"),
+		"default/nfs":     *testPVC("default", "nfs"),
+		"default/unbound": *testPVC("default", "unbound", withVolumeName("")),
+	}
+	f, err := s.newFileSystems("synchronizer-test-", "fs-1.efs.eu-west-1.amazonaws.com", "", "fs-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.resolveVolumes(context.Background(), client, pvcs); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]efsVolume{
+		"pv-same":  {fileSystemId: "fs-1"},
+		"pv-other": {fileSystemId: "fs-2", path: "/static"},
+	}
+	if !reflect.DeepEqual(f.volumes, want) {
+		t.Errorf("got volumes %+v, want %+v", f.volumes, want)
+	}
+	ids := f.fileSystemIds()
+	sort.Strings(ids)
+	if want := []string{"fs-1", "fs-2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got file systems %v, want %v", ids, want)
+	}
+}
+
+func TestIsMountPoint(t *testing.T) {
+	if got, err := isMountPoint("/"); err != nil || !got {
+		t.Errorf("got %t, %v for /, want true", got, err)
+	}
+	dir := t.TempDir()
+	if got, err := isMountPoint(dir); err != nil || got {
+		t.Errorf("got %t, %v for %s, want false", got, err, dir)
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := isMountPoint(file); err == nil {
+		t.Error("got no error for a file")
+	}
+}
+
+func TestNewFileSystemsMounted(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	calls := fakeCommand(t, "mount", 0)
+	if _, err := s.newFileSystems("synchronizer-test-", "", t.TempDir(), "fs-1"); ExitCode(err) != exitMount {
+		t.Errorf("got %v for a dir that isn't a mount point, want a mount error", err)
+	}
+
+	f, err := s.newFileSystems("synchronizer-test-", "", "/", "fs-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mountPath, err := f.mount(context.Background(), "fs-1"); err != nil || mountPath != "/" {
+		t.Errorf("got %q, %v, want the mount path", mountPath, err)
+	}
+	if _, err := f.mount(context.Background(), "fs-2"); ExitCode(err) != exitMount {
+		t.Errorf("got %v for another file system, want a mount error", err)
+	}
+	if got := fakeCalls(t, calls); len(got) != 0 {
+		t.Errorf("got mounts %q, want none", got)
+	}
+}
+
+func TestMountReadOnly(t *testing.T) {
+	s, fake, _ := testFakeRunner(t, &Opts{MountBinary: "mount", MountArgs: "-t nfs4"})
+	t.Cleanup(func() {
+		delete(s.mounted, "/tmp/synchronizer-test-fs-1")
+		os.RemoveAll("/tmp/synchronizer-test-fs-1")
+	})
+
+	f, err := s.newFileSystems("synchronizer-test-", "fs-1.efs.eu-west-1.amazonaws.com", "", "fs-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.readOnly = true
+	if _, err := f.mount(context.Background(), "fs-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mount", "-t", "nfs4", "-o", "ro", "fs-1.efs.eu-west-1.amazonaws.com:/", "/tmp/synchronizer-test-fs-1"}
+	if len(fake.calls) != 1 || !reflect.DeepEqual(fake.calls[0], want) {
+		t.Errorf("got commands %q, want %q", fake.calls, want)
+	}
+}
+
+func TestMountDryRun(t *testing.T) {
+	s, fake, _ := testFakeRunner(t, &Opts{MountBinary: "mount", DryRun: true, MountArgs: "-t nfs4"})
+	t.Cleanup(func() {
+		delete(s.mounted, "/tmp/synchronizer-test-fs-1")
+		os.RemoveAll("/tmp/synchronizer-test-fs-1")
+	})
+
+	f, err := s.newFileSystems("synchronizer-test-", "fs-1.efs.eu-west-1.amazonaws.com", "", "fs-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.readOnly = true
+	if _, err := f.mount(context.Background(), "fs-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("/tmp/synchronizer-test-fs-1"); err != nil {
+		t.Errorf("mount point not created in dry-run: %s", err)
+	}
+	want := []string{"mount", "-t", "nfs4", "-o", "ro", "fs-1.efs.eu-west-1.amazonaws.com:/", "/tmp/synchronizer-test-fs-1"}
+	if len(fake.calls) != 1 || !reflect.DeepEqual(fake.calls[0], want) {
+		t.Errorf("got commands %q, want %q", fake.calls, want)
+	}
+}
+
+func TestUnmountAllTimeout(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "umount"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer func(timeout time.Duration) { unmountTimeout = timeout }(unmountTimeout)
+	unmountTimeout = 100 * time.Millisecond
+	s := testSynchronizer(t, Opts{})
+	mountPath := filepath.Join(t.TempDir(), "fs-1")
+	s.mounted[mountPath] = true
+
+	start := time.Now()
+	logs := captureOutput(t, s, s.unmountAll)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("unmountAll took %s, want umount stopped after unmountTimeout", elapsed)
+	}
+	if !strings.Contains(logs, "WARN - Couldn't unmount "+mountPath) {
+		t.Errorf("got logs:\n%s\nwant a warning", logs)
+	}
+	if !s.mounted[mountPath] {
+		t.Error("mount path forgotten although umount failed")
+	}
+}
+
+func TestCheckMarker(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	mountPath := t.TempDir()
+	f := &fileSystems{s: s, mountPath: mountPath, fileSystemId: "fs-1"}
+
+	if err := f.checkMarker(context.Background(), ".volume-sync-source"); ExitCode(err) != exitMount {
+		t.Errorf("got %v without the marker, want a mount error", err)
+	}
+	if err := os.WriteFile(filepath.Join(mountPath, ".volume-sync-source"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.checkMarker(context.Background(), ".volume-sync-source"); err != nil {
+		t.Errorf("got %v with the marker", err)
+	}
+}
+
+func TestCheckDifferentFileSystems(t *testing.T) {
+	tests := []struct {
+		name           string
+		source, target *fileSystems
+		wantSame       bool
+	}{
+		{"different", &fileSystems{efsDNSName: "fs-1.efs", fileSystemId: "fs-1"}, &fileSystems{efsDNSName: "fs-2.efs", fileSystemId: "fs-2"}, false},
+		{"same dns name", &fileSystems{efsDNSName: "fs-1.efs"}, &fileSystems{efsDNSName: "fs-1.efs"}, true},
+		{"same mount path", &fileSystems{mountPath: "/mnt/efs/"}, &fileSystems{mountPath: "/mnt/efs"}, true},
+		{"same file system id", &fileSystems{efsDNSName: "nfs-a", fileSystemId: "fs-1"}, &fileSystems{efsDNSName: "nfs-b", fileSystemId: "fs-1"}, true},
+		{
+			"same file system of a pv",
+			&fileSystems{fileSystemId: "fs-1", volumes: map[string]efsVolume{"pv-1": {fileSystemId: "fs-3"}}},
+			&fileSystems{fileSystemId: "fs-2", volumes: map[string]efsVolume{"pv-2": {fileSystemId: "fs-3"}}},
+			true,
+		},
+		{"unknown file system ids", &fileSystems{mountPath: "/mnt/a"}, &fileSystems{mountPath: "/mnt/b"}, false},
+	}
+	for _, test := range tests {
+		err := checkDifferentFileSystems(test.source, test.target)
+		if (err != nil) != test.wantSame || (err != nil && ExitCode(err) != exitConfig) {
+			t.Errorf("%s: got %v, want same %t", test.name, err, test.wantSame)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package synchronizer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxRsyncArgvBytes is the size of rsync's arguments above which its
+// --exclude and --include patterns are passed in a file, well below the
+// ARG_MAX of Linux.
+const maxRsyncArgvBytes = 64 * 1024
+
+// withFilterFile moves the --exclude and --include patterns of args to a file
+// passed with --exclude-from, where the "- " and "+ " prefixes keep them
+// excludes and includes, when args are larger than maxRsyncArgvBytes. The
+// file takes the place of the first pattern, so that the patterns are still
+// evaluated in the same order among the other filter rules. It returns the
+// file to remove once rsync is done, if any.
+func (s *Synchronizer) withFilterFile(args []string) ([]string, string, error) {
+	size := 0
+	for _, arg := range args {
+		size += len(arg) + 1
+	}
+	if size <= maxRsyncArgvBytes {
+		return args, "", nil
+	}
+
+	rules := make([]string, 0)
+	kept := make([]string, 0, len(args))
+	first := -1
+	for i := 0; i < len(args); i++ {
+		rule, pattern := "", ""
+		switch arg := args[i]; {
+		case strings.HasPrefix(arg, "--exclude="):
+			rule, pattern = "- ", strings.TrimPrefix(arg, "--exclude=")
+		case strings.HasPrefix(arg, "--include="):
+			rule, pattern = "+ ", strings.TrimPrefix(arg, "--include=")
+		case (arg == "--exclude" || arg == "--include") && i+1 < len(args):
+			rule, pattern = "- ", args[i+1]
+			if arg == "--include" {
+				rule = "+ "
+			}
+			i++
+		default:
+			kept = append(kept, arg)
+			continue
+		}
+		if first < 0 {
+			first = len(kept)
+		}
+		rules = append(rules, rule+pattern)
+	}
+	if first < 0 {
+		return args, "", nil
+	}
+
+	f, err := os.CreateTemp("", "eks-volume-synchronizer-filter-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(rules, "\n") + "\n"); err != nil {
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	s.log(fmt.Sprintf("passing %d exclude and include patterns to rsync in %s", len(rules), f.Name()))
+	withFile := append(kept[:first:first], "--exclude-from="+f.Name())
+	return append(withFile, kept[first:]...), f.Name(), nil
+}
@@ -0,0 +1,49 @@
+package synchronizer
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithFilterFileSmallArgs(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	args := []string{"-a", "--exclude=*.tmp", "/src/", "/dst/"}
+	got, file, err := s.withFilterFile(args)
+	if err != nil || file != "" || !reflect.DeepEqual(got, args) {
+		t.Errorf("got %q, %q, %v, want the arguments unchanged", got, file, err)
+	}
+}
+
+func TestWithFilterFile(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	long := strings.Repeat("x", maxRsyncArgvBytes)
+	args := []string{"-a", "--filter=P .snapshot", "--exclude=" + long, "--include", "keep/", "--exclude", "*.tmp", "--delete", "/src/", "/dst/"}
+
+	got, file, err := s.withFilterFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+	want := []string{"-a", "--filter=P .snapshot", "--exclude-from=" + file, "--delete", "/src/", "/dst/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- " + long + "\n+ keep/\n- *.tmp\n"; string(content) != want {
+		t.Errorf("got rules %.80q..., want excludes and includes in order", content)
+	}
+}
+
+func TestWithFilterFileWithoutPatterns(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	args := []string{"-a", "--files-from=" + strings.Repeat("x", maxRsyncArgvBytes), "/src/", "/dst/"}
+	got, file, err := s.withFilterFile(args)
+	if err != nil || file != "" || !reflect.DeepEqual(got, args) {
+		t.Errorf("got %.80q, %q, %v, want the arguments unchanged", got, file, err)
+	}
+}
@@ -0,0 +1,59 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// health answers the liveness and readiness probes of a run inside a Pod.
+type health struct {
+	ready atomic.Bool
+}
+
+// startHealthServer serves /healthz, ok as long as the process runs, and
+// /readyz, ok once setReady is called, on addr (e.g. :8080). It returns a
+// function shutting the server down. Without addr nothing is served.
+func (s *Synchronizer) startHealthServer(addr string) (h *health, shutdown func(), err error) {
+	h = &health{}
+	if addr == "" {
+		return h, func() {}, nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !h.ready.Load() {
+			http.Error(w, "clients not loaded yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, configError("Couldn't listen on --healthAddr "+addr, err)
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.warn("Health server stopped: " + err.Error())
+		}
+	}()
+	s.log("serving /healthz and /readyz on " + listener.Addr().String())
+	return h, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+// setReady marks the run ready, once the clients of all the clusters are
+// loaded.
+func (h *health) setReady() {
+	h.ready.Store(true)
+}
@@ -0,0 +1,53 @@
+package synchronizer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthServer(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	var h *health
+	var shutdown func()
+	var err error
+	logs := captureOutput(t, s, func() { h, shutdown, err = s.startHealthServer("127.0.0.1:0") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+	_, addr, found := strings.Cut(strings.TrimSpace(logs), "serving /healthz and /readyz on ")
+	if !found {
+		t.Fatalf("address not logged, got logs:\n%s", logs)
+	}
+	status := func(path string) int {
+		t.Helper()
+		response, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	if got := status("/healthz"); got != http.StatusOK {
+		t.Errorf("got /healthz %d, want 200", got)
+	}
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("got /readyz %d before setReady, want 503", got)
+	}
+	h.setReady()
+	if got := status("/readyz"); got != http.StatusOK {
+		t.Errorf("got /readyz %d after setReady, want 200", got)
+	}
+}
+
+func TestHealthServerWithoutAddr(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	h, shutdown, err := s.startHealthServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.setReady()
+	shutdown()
+}
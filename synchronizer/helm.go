@@ -0,0 +1,53 @@
+package synchronizer
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helmInstanceLabel is the label Helm charts put on the resources of a
+// release, following Kubernetes' recommended labels.
+const helmInstanceLabel = "app.kubernetes.io/instance"
+
+// ordinalSuffix matches the -<ordinal> ending the name of a pvc created by a
+// StatefulSet from one of its volumeClaimTemplates.
+var ordinalSuffix = regexp.MustCompile(`^-[0-9]+$`)
+
+// withHelmRelease keeps the pvcs of the Helm release: the ones labeled with
+// its instance and the ones created from the volumeClaimTemplates of its
+// StatefulSets, named <template>-<statefulset>-<ordinal>, whose template may
+// not carry the label.
+func (s *Synchronizer) withHelmRelease(ctx context.Context, clientset kubernetes.Interface, pvcs map[string]v1.PersistentVolumeClaim, release string) (map[string]v1.PersistentVolumeClaim, error) {
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	statefulSets, err := clientset.AppsV1().StatefulSets("").List(apiCtx, metav1.ListOptions{LabelSelector: helmInstanceLabel + "=" + release})
+	if err != nil {
+		return nil, clusterError("Couldn't list the statefulsets of helm release "+release, s.cancelled(ctx, err))
+	}
+	prefixes := make([]string, 0)
+	for _, statefulSet := range statefulSets.Items {
+		for _, template := range statefulSet.Spec.VolumeClaimTemplates {
+			prefixes = append(prefixes, statefulSet.ObjectMeta.Namespace+"/"+template.ObjectMeta.Name+"-"+statefulSet.ObjectMeta.Name)
+		}
+	}
+
+	selected := make(map[string]v1.PersistentVolumeClaim)
+	for key, pvc := range pvcs {
+		if pvc.ObjectMeta.Labels[helmInstanceLabel] == release {
+			selected[key] = pvc
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) && ordinalSuffix.MatchString(strings.TrimPrefix(key, prefix)) {
+				selected[key] = pvc
+				break
+			}
+		}
+	}
+	return selected, nil
+}
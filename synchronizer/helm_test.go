@@ -0,0 +1,49 @@
+package synchronizer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// releaseStatefulSet returns a statefulset of the Helm release with a
+// volumeClaimTemplate named template.
+func releaseStatefulSet(release, namespace, name, template string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{helmInstanceLabel: release}},
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: template}}},
+		},
+	}
+}
+
+func TestWithHelmRelease(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	client := fake.NewSimpleClientset(
+		releaseStatefulSet("shop", "default", "db", "data"),
+		releaseStatefulSet("blog", "default", "web", "data"),
+	)
+	labeled := testPVC("default", "uploads")
+	labeled.Labels = map[string]string{helmInstanceLabel: "shop"}
+	pvcs := pvcMap(
+		labeled,
+		testPVC("default", "data-db-0"),
+		testPVC("default", "data-db-1"),
+		testPVC("default", "data-db-backup"),
+		testPVC("default", "data-web-0"),
+		testPVC("apps", "data-db-0"),
+	)
+
+	selected, err := s.withHelmRelease(context.Background(), client, pvcs, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(selected), []string{"default/data-db-0", "default/data-db-1", "default/uploads"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
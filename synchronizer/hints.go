@@ -0,0 +1,70 @@
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// remediationHints maps known failure conditions to a short hint on how to
+// fix them. The first matching hint wins.
+var remediationHints = []struct {
+	matches func(err error) bool
+	hint    string
+}{
+	{
+		matches: func(err error) bool { return errors.Is(err, exec.ErrNotFound) },
+		hint:    "install the missing binary on this host (e.g. yum install -y rsync nfs-utils)",
+	},
+	{
+		matches: func(err error) bool {
+			return containsAny(err, "no such host", "Name or service not known", "Failed to resolve server")
+		},
+		hint: "check --sourceEFSDNSName/--targetEFSDNSName and that this host resolves EFS DNS names (VPC DNS hostnames enabled)",
+	},
+	{
+		matches: func(err error) bool { return containsAny(err, "Connection timed out", "timed out") },
+		hint:    "ensure the EFS mount target's security group allows NFS (TCP 2049) from this host",
+	},
+	{
+		matches: func(err error) bool {
+			return apierrors.IsNotFound(err) && containsAny(err, "storageclasses")
+		},
+		hint: "check --sourceStorageClass/--targetStorageClass against `kubectl get storageclass` on each cluster",
+	},
+	{
+		matches: func(err error) bool { return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) },
+		hint:    "grant the permissions listed in the README to the user of the kube context",
+	},
+	{
+		matches: func(err error) bool {
+			return containsAny(err, "only root can", "permission denied", "Permission denied", "access denied")
+		},
+		hint: "run as root and check the EFS file system policy allows this host to mount it",
+	},
+}
+
+// withHint appends a remediation hint to err when one is known.
+func withHint(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, remediation := range remediationHints {
+		if remediation.matches(err) {
+			return fmt.Errorf("%w\nhint: %s", err, remediation.hint)
+		}
+	}
+	return err
+}
+
+func containsAny(err error, substrings ...string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(err.Error(), substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestWithHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHint string
+	}{
+		{"missing binary", &exec.Error{Name: "rsync", Err: exec.ErrNotFound}, "install the missing binary"},
+		{"dns", errors.New("mount.nfs4: Failed to resolve server fs-1.efs.eu-west-1.amazonaws.com"), "resolves EFS DNS names"},
+		{"timeout", errors.New("mount.nfs4: Connection timed out"), "allows NFS (TCP 2049)"},
+		{"storage class", apierrors.NewNotFound(storagev1.Resource("storageclasses"), "efs-sc"), "kubectl get storageclass"},
+		{"forbidden", apierrors.NewForbidden(storagev1.Resource("storageclasses"), "efs-sc", errors.New("no access")), "grant the permissions"},
+		{"wrapped", fmt.Errorf("Couldn't mount: %w", errors.New("mount: only root can do that")), "run as root"},
+		{"unknown", errors.New("disk full"), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := withHint(test.err)
+			if !errors.Is(got, test.err) {
+				t.Errorf("%v doesn't wrap %v", got, test.err)
+			}
+			_, hint, found := strings.Cut(got.Error(), "\nhint: ")
+			if found != (test.wantHint != "") || !strings.Contains(hint, test.wantHint) {
+				t.Errorf("got %q, want hint %q", got, test.wantHint)
+			}
+		})
+	}
+	if withHint(nil) != nil {
+		t.Error("got a hint for no error")
+	}
+}
@@ -0,0 +1,29 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// runHook runs command with sh, once for the whole run, and logs its output.
+// It is stopped like the mount and rsync commands when ctx is done. In
+// dry-run the command is only printed. The command is printed redacted like
+// the mount and rsync ones, word by word.
+func (s *Synchronizer) runHook(ctx context.Context, flag, command string) error {
+	s.log("running " + flag + "...")
+	s.printLine(redactCommand("sh", append([]string{"-c"}, strings.Fields(command)...)...))
+	if s.Opts.DryRun {
+		return nil
+	}
+	output, err := s.commandRunner(ctx).Run("sh", "-c", command)
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		if line != "" {
+			s.log(flag + ": " + line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", flag, s.cancelled(ctx, err))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHook(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	var err error
+	logs := captureOutput(t, s, func() { err = s.runHook(context.Background(), "preRunCommand", "echo scaled down; echo apps/web") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"preRunCommand: scaled down\n", "preRunCommand: apps/web\n"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("output not logged, got logs:\n%s", logs)
+		}
+	}
+}
+
+func TestRunHookFailure(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	var err error
+	captureOutput(t, s, func() { err = s.runHook(context.Background(), "postRunCommand", "exit 1") })
+	if err == nil || err.Error() != "postRunCommand failed: exit status 1" {
+		t.Errorf("got %v, want the failure of postRunCommand", err)
+	}
+}
+
+func TestRunHookDryRun(t *testing.T) {
+	s := testSynchronizer(t, Opts{DryRun: true})
+	marker := t.TempDir() + "/x"
+	var err error
+	logs := captureOutput(t, s, func() { err = s.runHook(context.Background(), "preRunCommand", "touch "+marker) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("command run in dry-run")
+	}
+	if !strings.Contains(logs, "sh -c touch "+marker) {
+		t.Errorf("command not printed, got logs:\n%s", logs)
+	}
+}
+
+func TestRunHookCancelled(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	var err error
+	captureOutput(t, s, func() { err = s.runHook(ctx, "preRunCommand", "exec sleep 10") })
+	if err == nil || time.Since(started) > 5*time.Second {
+		t.Errorf("got %v after %s, want the hook stopped with the run", err, time.Since(started))
+	}
+}
+
+func TestRunHookRunner(t *testing.T) {
+	s, fake, logs := testFakeRunner(t, &Opts{})
+	fake.output = []byte("scaled down\n")
+	if err := s.runHook(context.Background(), "preRunCommand", "kubectl scale --replicas=0 deploy/web"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sh", "-c", "kubectl scale --replicas=0 deploy/web"}; len(fake.calls) != 1 || !reflect.DeepEqual(fake.calls[0], want) {
+		t.Errorf("got commands %q, want %q", fake.calls, want)
+	}
+	if !strings.Contains(logs.String(), "preRunCommand: scaled down") {
+		t.Errorf("output not logged, got logs:\n%s", logs)
+	}
+}
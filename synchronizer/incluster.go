@@ -0,0 +1,74 @@
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// inClusterContext names the cluster the synchronizer runs in as a Pod,
+	// in logs and wherever a context name is expected.
+	inClusterContext        = "in-cluster"
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// runningInCluster tells whether the process runs in a Pod with a service
+// account token mounted.
+func runningInCluster() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return false
+	}
+	_, err := os.Stat(serviceAccountTokenFile)
+	return err == nil
+}
+
+// resolveInCluster tells which side, "source" or "target", uses the
+// in-cluster configuration: the one given by --inCluster or, inside a Pod,
+// the only side without a context. Contexts given for that side conflict.
+func (s *Synchronizer) resolveInCluster(opts *Opts) (string, error) {
+	sourceContextGiven := opts.SourceEKSContext != "" || opts.Context != "" || os.Getenv(pluginContextEnv) != ""
+	targetContextGiven := len(opts.TargetEKSContext) > 0
+	side := opts.InCluster
+	if side == "" && runningInCluster() {
+		if !sourceContextGiven && !targetContextGiven {
+			return "", configError("parse error", errors.New("only one of the source and the target can be the cluster this Pod runs in, set a context for the other"))
+		}
+		if !sourceContextGiven {
+			side = "source"
+		} else if !targetContextGiven {
+			side = "target"
+		}
+	}
+	switch {
+	case side == "source" && (opts.SourceEKSContext != "" || opts.Context != ""):
+		return "", configError("parse error", errors.New("--inCluster=source conflicts with --sourceEKSContext and --context"))
+	case side == "target" && targetContextGiven:
+		return "", configError("parse error", errors.New("--inCluster=target conflicts with --targetEKSContext"))
+	case side == "target" && len(opts.TargetAwsProfile) > 0, side == "source" && opts.SourceAwsProfile != "":
+		return "", configError("parse error", fmt.Errorf("--inCluster=%s uses the Pod's service account, AWS profiles don't apply", side))
+	case side == "target" && len(opts.TargetCAFile) > 0, side == "source" && opts.SourceCAFile != "":
+		return "", configError("parse error", fmt.Errorf("--inCluster=%s uses the Pod's service account CA, CA files don't apply", side))
+	}
+	if side != "" {
+		s.log(fmt.Sprintf("using the in-cluster configuration for the %s", side))
+	}
+	return side, nil
+}
+
+// getInClusterK8sClient builds a client from the service account of the Pod
+// the synchronizer runs in.
+func getInClusterK8sClient() (kubernetes.Interface, string, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, "", clusterError("Fail to build the in-cluster k8s config", err)
+	}
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, "", clusterError("Fail to create the in-cluster clientSet", err)
+	}
+	return clientSet, inClusterContext, nil
+}
@@ -0,0 +1,192 @@
+package synchronizer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Environment variables set by kubectl when the binary runs as a plugin
+// (kubectl volume-sync), carrying kubectl's own global flags.
+const (
+	pluginKubeconfigEnv = "KUBECTL_PLUGINS_GLOBAL_FLAG_KUBECONFIG"
+	pluginContextEnv    = "KUBECTL_PLUGINS_GLOBAL_FLAG_CONTEXT"
+)
+
+// sourceContextFromEnv resolves the source context, in order of precedence,
+// from --sourceEKSContext, --context and kubectl's plugin environment.
+func sourceContextFromEnv(sourceEKSContext, context string) (string, error) {
+	for _, candidate := range []string{sourceEKSContext, context, os.Getenv(pluginContextEnv)} {
+		if candidate != "" {
+			return candidate, nil
+		}
+	}
+	return "", configError("parse error", errors.New("the required flag `--sourceEKSContext' (or `--context') was not specified"))
+}
+
+// kubeconfigLoadingRules loads the kubeconfig given by --kubeconfig or, when
+// running as a plugin, by kubectl and otherwise follows kubectl's rules: the
+// KUBECONFIG list, then ~/.kube/config.
+func kubeconfigLoadingRules(kubeconfig string) *clientcmd.ClientConfigLoadingRules {
+	if kubeconfig == "" {
+		kubeconfig = os.Getenv(pluginKubeconfigEnv)
+	}
+	if kubeconfig != "" {
+		return &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+	}
+	return clientcmd.NewDefaultClientConfigLoadingRules()
+}
+
+// checkKubeconfigReadable returns an error, listing the paths tried, when
+// none of the kubeconfig files of loadingRules can be read. kubectl's rules
+// would otherwise silently load an empty config.
+func checkKubeconfigReadable(loadingRules *clientcmd.ClientConfigLoadingRules) error {
+	paths := loadingRules.GetLoadingPrecedence()
+	if loadingRules.ExplicitPath != "" {
+		paths = []string{loadingRules.ExplicitPath}
+	}
+	for _, path := range paths {
+		if file, err := os.Open(path); err == nil {
+			file.Close()
+			return nil
+		}
+	}
+	return configError("Fail to load kubeconfig", fmt.Errorf("none of the kubeconfig files is readable, tried: %s (set --kubeconfig or KUBECONFIG)", strings.Join(paths, ", ")))
+}
+
+// getK8sClientForContext builds a client for context, or for the cluster the
+// synchronizer runs in when inCluster is set. When awsProfile is set it is
+// the AWS_PROFILE of the exec credential plugin of the context, e.g. aws eks
+// get-token. When caFile is set its certificates are trusted for the API
+// server too.
+func (s *Synchronizer) getK8sClientForContext(context, awsProfile, caFile string, inCluster bool) (kubernetes.Interface, string, error) {
+	if inCluster {
+		return getInClusterK8sClient()
+	}
+	loadingRules := kubeconfigLoadingRules(s.Opts.Kubeconfig)
+	if err := checkKubeconfigReadable(loadingRules); err != nil {
+		return nil, "", err
+	}
+	rawConfig, err := loadingRules.Load()
+	if err != nil {
+		return nil, "", configError(fmt.Sprintf("Fail to load kubeconfig %s", strings.Join(loadingRules.GetLoadingPrecedence(), string(filepath.ListSeparator))), err)
+	}
+
+	contextNames := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
+		contextNames = append(contextNames, name)
+	}
+	resolved, err := resolveContext(contextNames, context)
+	if err != nil {
+		return nil, "", configError(fmt.Sprintf("Fail to find context %s", context), err)
+	}
+	if resolved != context {
+		s.log(fmt.Sprintf("context %s resolved to %s", context, resolved))
+	}
+	context = resolved
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{
+			CurrentContext: context,
+		}).ClientConfig()
+	if err != nil {
+		return nil, "", configError(fmt.Sprintf("Fail to build the k8s config for context %s", context), err)
+	}
+	if awsProfile != "" {
+		if config.ExecProvider == nil {
+			return nil, "", configError(fmt.Sprintf("Can't use AWS profile %s for context %s", awsProfile, context), errors.New("the context doesn't use an exec credential plugin"))
+		}
+		config.ExecProvider = withExecEnv(config.ExecProvider, "AWS_PROFILE", awsProfile)
+		s.log(fmt.Sprintf("using AWS profile %s for context %s", awsProfile, context))
+	}
+	if caFile != "" {
+		if err := withCAFile(config, caFile); err != nil {
+			return nil, "", configError(fmt.Sprintf("Can't use CA file %s for context %s", caFile, context), err)
+		}
+		s.log(fmt.Sprintf("using CA file %s for context %s", caFile, context))
+	}
+
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, "", clusterError(fmt.Sprintf("Fail to create clientSet for context %s", context), err)
+	}
+
+	return clientSet, context, nil
+}
+
+// withExecEnv returns a copy of execConfig with the environment variable name
+// set to value, replacing any value set in the kubeconfig.
+func withExecEnv(execConfig *clientcmdapi.ExecConfig, name, value string) *clientcmdapi.ExecConfig {
+	copied := *execConfig
+	copied.Env = make([]clientcmdapi.ExecEnvVar, 0, len(execConfig.Env)+1)
+	for _, env := range execConfig.Env {
+		if env.Name != name {
+			copied.Env = append(copied.Env, env)
+		}
+	}
+	copied.Env = append(copied.Env, clientcmdapi.ExecEnvVar{Name: name, Value: value})
+	return &copied
+}
+
+// withCAFile adds the PEM certificates of caFile to the CAs config trusts,
+// keeping the ones of the kubeconfig, for clusters signed by a private CA.
+// Verifying the server certificate is then enforced, even if the kubeconfig
+// skips it.
+func withCAFile(config *rest.Config, caFile string) error {
+	caData, err := os.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(caData) {
+		return fmt.Errorf("%s has no PEM certificate", caFile)
+	}
+	existing := config.TLSClientConfig.CAData
+	if len(existing) == 0 && config.TLSClientConfig.CAFile != "" {
+		existing, err = os.ReadFile(config.TLSClientConfig.CAFile)
+		if err != nil {
+			return err
+		}
+	}
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		existing = append(existing, '\n')
+	}
+	config.TLSClientConfig.CAData = append(existing, caData...)
+	config.TLSClientConfig.CAFile = ""
+	config.TLSClientConfig.Insecure = false
+	return nil
+}
+
+// resolveContext returns the context named exactly as name or, failing that,
+// the only context containing name, so a cluster name fragment can be used
+// instead of the full EKS ARN.
+func resolveContext(contextNames []string, name string) (string, error) {
+	matches := make([]string, 0)
+	for _, contextName := range contextNames {
+		if contextName == name {
+			return contextName, nil
+		}
+		if strings.Contains(contextName, name) {
+			matches = append(matches, contextName)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no context matches %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		sort.Strings(matches)
+		return "", fmt.Errorf("%q is ambiguous, it matches contexts: %s", name, strings.Join(matches, ", "))
+	}
+}
@@ -0,0 +1,181 @@
+package synchronizer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestResolveContext(t *testing.T) {
+	contextNames := []string{
+		"arn:aws:eks:eu-west-1:123456789012:cluster/prod",
+		"arn:aws:eks:eu-west-1:123456789012:cluster/prod-old",
+		"arn:aws:eks:eu-west-1:123456789012:cluster/staging",
+		"prod",
+	}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"prod", "prod", ""},
+		{"staging", "arn:aws:eks:eu-west-1:123456789012:cluster/staging", ""},
+		{"cluster/prod-old", "arn:aws:eks:eu-west-1:123456789012:cluster/prod-old", ""},
+		{"cluster/prod", "", `"cluster/prod" is ambiguous, it matches contexts: arn:aws:eks:eu-west-1:123456789012:cluster/prod, arn:aws:eks:eu-west-1:123456789012:cluster/prod-old`},
+		{"dev", "", `no context matches "dev"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := resolveContext(contextNames, test.name)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %q, %v, want error %q", got, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("got %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceContextFromEnv(t *testing.T) {
+	tests := []struct {
+		name             string
+		sourceEKSContext string
+		context          string
+		env              string
+		want             string
+	}{
+		{"sourceEKSContext first", "source", "context", "plugin", "source"},
+		{"context", "", "context", "plugin", "context"},
+		{"kubectl plugin", "", "", "plugin", "plugin"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(pluginContextEnv, test.env)
+			if got, err := sourceContextFromEnv(test.sourceEKSContext, test.context); err != nil || got != test.want {
+				t.Errorf("got %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+	t.Run("missing", func(t *testing.T) {
+		t.Setenv(pluginContextEnv, "")
+		if _, err := sourceContextFromEnv("", ""); ExitCode(err) != exitConfig {
+			t.Errorf("got %v without a source context, want a config error", err)
+		}
+	})
+}
+
+func TestKubeconfigLoadingRules(t *testing.T) {
+	t.Setenv(pluginKubeconfigEnv, "/plugin/config")
+	if got := kubeconfigLoadingRules("/explicit/config").ExplicitPath; got != "/explicit/config" {
+		t.Errorf("got %q, want --kubeconfig", got)
+	}
+	if got := kubeconfigLoadingRules("").ExplicitPath; got != "/plugin/config" {
+		t.Errorf("got %q, want kubectl's kubeconfig", got)
+	}
+	t.Setenv(pluginKubeconfigEnv, "")
+	if got := kubeconfigLoadingRules("").ExplicitPath; got != "" {
+		t.Errorf("got %q, want kubectl's default rules", got)
+	}
+}
+
+func TestWithExecEnv(t *testing.T) {
+	execConfig := &clientcmdapi.ExecConfig{
+		Command: "aws",
+		Env:     []clientcmdapi.ExecEnvVar{{Name: "AWS_PROFILE", Value: "default"}, {Name: "AWS_REGION", Value: "eu-west-1"}},
+	}
+
+	got := withExecEnv(execConfig, "AWS_PROFILE", "admin")
+	want := []clientcmdapi.ExecEnvVar{{Name: "AWS_REGION", Value: "eu-west-1"}, {Name: "AWS_PROFILE", Value: "admin"}}
+	if !reflect.DeepEqual(got.Env, want) || got.Command != "aws" {
+		t.Errorf("got %+v, want env %+v", got, want)
+	}
+	if execConfig.Env[0].Value != "default" {
+		t.Errorf("kubeconfig's exec config changed: %+v", execConfig.Env)
+	}
+}
+
+// testCAFile writes a self-signed PEM certificate to a file and returns its
+// path and content.
+func testCAFile(t *testing.T, name string) (string, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	path := filepath.Join(t.TempDir(), name+".pem")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+func TestWithCAFile(t *testing.T) {
+	caFile, ca := testCAFile(t, "private")
+	kubeconfigCAFile, kubeconfigCA := testCAFile(t, "kubeconfig")
+	tests := []struct {
+		name   string
+		config rest.TLSClientConfig
+		want   []byte
+	}{
+		{"no CA", rest.TLSClientConfig{}, ca},
+		{"CA data", rest.TLSClientConfig{CAData: bytes.TrimSuffix(kubeconfigCA, []byte("\n"))}, append(append([]byte{}, kubeconfigCA...), ca...)},
+		{"CA file", rest.TLSClientConfig{CAFile: kubeconfigCAFile}, append(append([]byte{}, kubeconfigCA...), ca...)},
+		{"insecure", rest.TLSClientConfig{Insecure: true}, ca},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &rest.Config{TLSClientConfig: test.config}
+			if err := withCAFile(config, caFile); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(config.TLSClientConfig.CAData, test.want) {
+				t.Errorf("got CA data:\n%s\nwant:\n%s", config.TLSClientConfig.CAData, test.want)
+			}
+			if config.TLSClientConfig.CAFile != "" || config.TLSClientConfig.Insecure {
+				t.Errorf("got %+v, want the CA data verified", config.TLSClientConfig)
+			}
+		})
+	}
+}
+
+func TestWithCAFileInvalid(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, caFile := range []string{notPEM, filepath.Join(t.TempDir(), "missing.pem")} {
+		if err := withCAFile(&rest.Config{}, caFile); err == nil {
+			t.Errorf("got no error for %s", caFile)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package synchronizer
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/api/core/v1"
+)
+
+// byteLimiter caps the sum of estimated sizes of the transfers in flight.
+// A capacity of 0 means unlimited.
+// released is closed, and replaced, on every release to wake up the waiting
+// acquires.
+type byteLimiter struct {
+	mu       sync.Mutex
+	capacity int64
+	inFlight int64
+	released chan struct{}
+}
+
+func newByteLimiter(capacity int64) *byteLimiter {
+	return &byteLimiter{capacity: capacity, released: make(chan struct{})}
+}
+
+// acquire blocks until size fits under the capacity, or ctx is done, and
+// returns the weight that must be given back to release. A volume bigger than
+// the whole capacity is admitted alone, otherwise it would never be scheduled.
+func (l *byteLimiter) acquire(ctx context.Context, size int64) (int64, error) {
+	if l.capacity <= 0 {
+		return 0, nil
+	}
+	if size > l.capacity {
+		size = l.capacity
+	}
+	for {
+		l.mu.Lock()
+		if l.inFlight+size <= l.capacity {
+			l.inFlight += size
+			l.mu.Unlock()
+			return size, nil
+		}
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (l *byteLimiter) release(weight int64) {
+	if weight == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.inFlight -= weight
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// volumeSize estimates the size of a volume from its storage request.
+func volumeSize(pvc v1.PersistentVolumeClaim) int64 {
+	request, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return 0
+	}
+	return request.Value()
+}
@@ -0,0 +1,175 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestByteLimiterUnlimited(t *testing.T) {
+	l := newByteLimiter(0)
+	if weight, err := l.acquire(context.Background(), 1<<40); weight != 0 || err != nil {
+		t.Errorf("got weight %d, %v, want 0", weight, err)
+	}
+	l.release(0)
+}
+
+func TestByteLimiterAdmitsBigVolumeAlone(t *testing.T) {
+	l := newByteLimiter(10)
+	if weight, err := l.acquire(context.Background(), 100); weight != 10 || err != nil {
+		t.Errorf("got weight %d, %v, want the capacity 10", weight, err)
+	}
+}
+
+func TestByteLimiterBlocksOverCapacity(t *testing.T) {
+	l := newByteLimiter(10)
+	first, _ := l.acquire(context.Background(), 6)
+
+	acquired := make(chan int64)
+	go func() {
+		weight, _ := l.acquire(context.Background(), 5)
+		acquired <- weight
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired 5 with 6 of 10 in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.release(first)
+	select {
+	case weight := <-acquired:
+		if weight != 5 {
+			t.Errorf("got weight %d, want 5", weight)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still blocked after release")
+	}
+}
+
+func TestByteLimiterCancelled(t *testing.T) {
+	l := newByteLimiter(10)
+	l.acquire(context.Background(), 6)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	acquired := make(chan error)
+	go func() {
+		_, err := l.acquire(ctx, 5)
+		acquired <- err
+	}()
+	cancel()
+	select {
+	case err := <-acquired:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want the context error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still blocked after the context was cancelled")
+	}
+	if l.inFlight != 6 {
+		t.Errorf("got %d in flight, want the 6 acquired", l.inFlight)
+	}
+}
+
+// inFlightRunner records the most bytes, by the sizes of the source dirs it
+// is given, rsynced at the same time, each rsync taking a little while.
+type inFlightRunner struct {
+	fakeRunner
+	sizes    map[string]int64
+	mu       sync.Mutex
+	inFlight int64
+	most     int64
+}
+
+func (r *inFlightRunner) Run(name string, args ...string) ([]byte, error) {
+	size := r.sizes[args[len(args)-2]]
+	r.mu.Lock()
+	r.inFlight += size
+	r.most = max(r.most, r.inFlight)
+	r.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	r.inFlight -= size
+	r.mu.Unlock()
+	return r.fakeRunner.Run(name, args...)
+}
+
+func TestRsyncDirsMaxInFlightBytes(t *testing.T) {
+	sizes := map[string]int64{"a": 6, "b": 5, "c": 4, "d": 3}
+	pvcs := make([]*v1.PersistentVolumeClaim, 0, len(sizes))
+	objects := make([]runtime.Object, 0, len(sizes))
+	for name := range sizes {
+		pvc := testPVC("default", name, withStorageClass("efs-sc"))
+		pvcs = append(pvcs, pvc)
+		objects = append(objects, pvc)
+	}
+	source, target := testClusters(objects...)
+	bindTargets(t, target, pvcs...)
+	s, _, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", RsyncArgs: "-a", Parallelism: 4, IntraVolumeParallelism: 1, MaxInFlightBytes: "10"})
+	s.sizeEstimate = func(pvc v1.PersistentVolumeClaim) int64 { return sizes[pvc.Name] }
+	sourcePath, targetPath := t.TempDir(), t.TempDir()
+	fake := &inFlightRunner{sizes: make(map[string]int64)}
+	for name, size := range sizes {
+		fake.sizes[sourcePath+"/pv-"+name+"/"] = size
+	}
+	s.Runner = fake
+
+	pending, err := s.RsyncDirs(context.Background(), source, target, sourcePath, targetPath, pvcMap(pvcs...), targetPVCs(t, target))
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("got pending %v, %v, want all rsynced", pending, err)
+	}
+	if len(fake.calls) != len(sizes) {
+		t.Errorf("got %d rsyncs, want one per volume", len(fake.calls))
+	}
+	if fake.most > 10 || fake.most < 7 {
+		t.Errorf("got at most %d bytes in flight with --maxInFlightBytes=10, want volumes rsynced together up to 10", fake.most)
+	}
+}
+
+// blockingRunner runs its commands until ctx is done.
+type blockingRunner struct {
+	fakeRunner
+	ctx context.Context
+}
+
+func (r *blockingRunner) Run(name string, args ...string) ([]byte, error) {
+	<-r.ctx.Done()
+	return r.fakeRunner.Run(name, args...)
+}
+
+func TestRsyncDirsMaxInFlightBytesCancelled(t *testing.T) {
+	a, b := testPVC("default", "a", withStorageClass("efs-sc")), testPVC("default", "b", withStorageClass("efs-sc"))
+	source, target := testClusters(a, b)
+	bindTargets(t, target, a, b)
+	s, _, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", RsyncArgs: "-a", Parallelism: 2, IntraVolumeParallelism: 1, MaxInFlightBytes: "10"})
+	s.sizeEstimate = func(v1.PersistentVolumeClaim) int64 { return 10 }
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fake := &blockingRunner{ctx: ctx}
+	s.Runner = fake
+
+	_, err := s.RsyncDirs(ctx, source, target, t.TempDir(), t.TempDir(), pvcMap(a, b), targetPVCs(t, target))
+	if err == nil || !strings.Contains(err.Error(), "Stopped rsyncing to the target") {
+		t.Errorf("got %v, want the run stopped while waiting for --maxInFlightBytes", err)
+	}
+	if len(fake.calls) != 1 {
+		t.Errorf("got commands %q, want the second volume never rsynced", fake.calls)
+	}
+}
+
+func TestVolumeSize(t *testing.T) {
+	if got := volumeSize(*testPVC("default", "data", withSize("2Gi"))); got != 2<<30 {
+		t.Errorf("got %d, want %d", got, 2<<30)
+	}
+	pvc := testPVC("default", "data")
+	delete(pvc.Spec.Resources.Requests, v1.ResourceStorage)
+	if got := volumeSize(*pvc); got != 0 {
+		t.Errorf("got %d without request, want 0", got)
+	}
+}
@@ -0,0 +1,155 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	lockName          = "eks-volume-synchronizer"
+	lockDuration      = 2 * time.Minute
+	lockRenewInterval = 30 * time.Second
+	lockPollInterval  = 10 * time.Second
+)
+
+// acquireLock takes a Lease on the target cluster so that a concurrent run
+// against the same target refuses to start, or waits up to wait for it to
+// finish. The lease is renewed until the returned function releases it.
+func (s *Synchronizer) acquireLock(ctx context.Context, clientset kubernetes.Interface, clusterContext, namespace string, wait time.Duration) (release func(), err error) {
+	holder := lockHolder()
+	deadline := time.Now().Add(wait)
+	for {
+		apiCtx, cancel := s.apiContext(ctx)
+		lease, err := tryLock(apiCtx, clientset, namespace, holder)
+		cancel()
+		if err == nil {
+			s.log(fmt.Sprintf("lock %s/%s acquired on %s", namespace, lockName, clusterContext))
+			return s.keepLock(clientset, lease), nil
+		}
+		if !errorIsHeldLock(err) || time.Now().After(deadline) {
+			return nil, clusterError(fmt.Sprintf("Couldn't lock %s, is another synchronization running against it?", clusterContext), s.cancelled(ctx, err))
+		}
+		s.log(fmt.Sprintf("waiting for lock on %s: %s", clusterContext, err))
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return nil, clusterError(fmt.Sprintf("Couldn't lock %s", clusterContext), s.cancelled(ctx, ctx.Err()))
+		}
+	}
+}
+
+// heldLockError means the lease is held by another, live, run.
+type heldLockError struct {
+	holder string
+	since  time.Time
+}
+
+func (e heldLockError) Error() string {
+	return fmt.Sprintf("lock %s is held by %s since %s", lockName, e.holder, e.since.Format(time.RFC3339))
+}
+
+func errorIsHeldLock(err error) bool {
+	_, ok := err.(heldLockError)
+	return ok || apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+}
+
+// tryLock creates the lease, or takes it over if its holder stopped renewing it.
+func tryLock(ctx context.Context, clientset kubernetes.Interface, namespace, holder string) (*coordinationv1.Lease, error) {
+	leases := clientset.CoordinationV1().Leases(namespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(lockDuration.Seconds())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &durationSeconds,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+
+	lease, err := leases.Get(ctx, lockName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: lockName, Namespace: namespace},
+			Spec:       spec,
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" && !leaseExpired(lease) {
+		since := time.Time{}
+		if lease.Spec.AcquireTime != nil {
+			since = lease.Spec.AcquireTime.Time
+		}
+		return nil, heldLockError{holder: *lease.Spec.HolderIdentity, since: since}
+	}
+	lease.Spec = spec
+	return leases.Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+// keepLock renews the lease until the returned function is called, which
+// releases it.
+func (s *Synchronizer) keepLock(clientset kubernetes.Interface, lease *coordinationv1.Lease) func() {
+	leases := clientset.CoordinationV1().Leases(lease.ObjectMeta.Namespace)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lockRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				apiCtx, cancel := s.apiContext(context.Background())
+				renewed, err := leases.Update(apiCtx, lease, metav1.UpdateOptions{})
+				cancel()
+				if err != nil {
+					s.warn(fmt.Sprintf("Couldn't renew lock %s: %s", lockName, err))
+					continue
+				}
+				lease = renewed
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		apiCtx, cancel := s.apiContext(context.Background())
+		defer cancel()
+		err := leases.Delete(apiCtx, lease.ObjectMeta.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ObjectMeta.ResourceVersion},
+		})
+		if err != nil {
+			s.warn(fmt.Sprintf("Couldn't release lock %s: %s", lockName, err))
+			return
+		}
+		s.log("lock " + lockName + " released")
+	}
+}
+
+func lockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
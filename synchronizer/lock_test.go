@@ -0,0 +1,110 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// heldLease returns the lock lease of holder, last renewed at renewTime.
+func heldLease(holder string, renewTime time.Time) *coordinationv1.Lease {
+	durationSeconds := int32(lockDuration.Seconds())
+	renewed := metav1.NewMicroTime(renewTime)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: lockName, Namespace: "default"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &durationSeconds,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+		},
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	tests := []struct {
+		name  string
+		lease *coordinationv1.Lease
+		want  bool
+	}{
+		{"renewed", heldLease("other", time.Now()), false},
+		{"not renewed", heldLease("other", time.Now().Add(-lockDuration-time.Second)), true},
+		{"never renewed", &coordinationv1.Lease{}, true},
+	}
+	for _, test := range tests {
+		if got := leaseExpired(test.lease); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *coordinationv1.Lease
+		wantHeld bool
+	}{
+		{"free", nil, false},
+		{"held", heldLease("other/1", time.Now()), true},
+		{"expired", heldLease("other/1", time.Now().Add(-time.Hour)), false},
+		{"released", heldLease("", time.Now()), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if test.existing != nil {
+				client = fake.NewSimpleClientset(test.existing)
+			}
+
+			lease, err := tryLock(context.Background(), client, "default", "me/1")
+			if test.wantHeld {
+				var held heldLockError
+				if !errors.As(err, &held) || held.holder != "other/1" || !errorIsHeldLock(err) {
+					t.Errorf("got %v, want the lock held by other/1", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *lease.Spec.HolderIdentity != "me/1" || leaseExpired(lease) {
+				t.Errorf("got lease %+v, want it held by me/1", lease.Spec)
+			}
+		})
+	}
+}
+
+func TestErrorIsHeldLock(t *testing.T) {
+	if !errorIsHeldLock(apierrors.NewConflict(coordinationv1.Resource("leases"), lockName, errors.New("changed"))) {
+		t.Error("conflict updating the lease isn't a held lock")
+	}
+	if !errorIsHeldLock(apierrors.NewAlreadyExists(coordinationv1.Resource("leases"), lockName)) {
+		t.Error("lease created concurrently isn't a held lock")
+	}
+	if errorIsHeldLock(apierrors.NewForbidden(coordinationv1.Resource("leases"), lockName, errors.New("no access"))) {
+		t.Error("forbidden is a held lock")
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	client := fake.NewSimpleClientset()
+
+	release, err := s.acquireLock(context.Background(), client, "target", "default", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.acquireLock(context.Background(), fake.NewSimpleClientset(heldLease("other/1", time.Now())), "target", "default", 0); ExitCode(err) != exitCluster {
+		t.Errorf("got %v, want a cluster error for a held lock", err)
+	}
+	release()
+	if _, err := client.CoordinationV1().Leases("default").Get(context.Background(), lockName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("got %v, want the lease deleted", err)
+	}
+}
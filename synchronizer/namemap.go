@@ -0,0 +1,71 @@
+package synchronizer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// nameMap maps the keys (namespace/name) of source PVCs to the keys of the
+// PVCs they are synchronized to on the target. PVCs that aren't in the map
+// keep their key.
+type nameMap map[string]string
+
+// loadNameMap reads a name map from path, made of
+// srcNamespace/srcName=dstNamespace/dstName lines. Empty lines and lines
+// starting with # are ignored.
+func loadNameMap(path string) (nameMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mapping := make(nameMap)
+	destinations := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		source, destination, ok := strings.Cut(line, "=")
+		source, destination = strings.TrimSpace(source), strings.TrimSpace(destination)
+		if !ok || !isPVCKey(source) || !isPVCKey(destination) {
+			return nil, fmt.Errorf("%s:%d: %q isn't of the form srcNamespace/srcName=dstNamespace/dstName", path, lineNumber, line)
+		}
+		if _, ok := mapping[source]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is mapped more than once", path, lineNumber, source)
+		}
+		if other, ok := destinations[destination]; ok {
+			return nil, fmt.Errorf("%s:%d: %s and %s are both mapped to %s", path, lineNumber, other, source, destination)
+		}
+		mapping[source] = destination
+		destinations[destination] = source
+	}
+	return mapping, scanner.Err()
+}
+
+func isPVCKey(key string) bool {
+	namespace, name, ok := strings.Cut(key, "/")
+	return ok && namespace != "" && name != "" && !strings.Contains(name, "/")
+}
+
+// target returns the key of the target PVC of the source PVC sourceKey.
+func (m nameMap) target(sourceKey string) string {
+	if targetKey, ok := m[sourceKey]; ok {
+		return targetKey
+	}
+	return sourceKey
+}
+
+// isTarget tells whether key is the destination of a mapped source PVC.
+func (m nameMap) isTarget(key string) bool {
+	for _, targetKey := range m {
+		if targetKey == key {
+			return true
+		}
+	}
+	return false
+}
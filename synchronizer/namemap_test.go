@@ -0,0 +1,96 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// nameMapFile writes content to a name map file and returns its path.
+func nameMapFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadNameMap(t *testing.T) {
+	path := nameMapFile(t, "# renamed for the new cluster\n\nlegacy/data = apps/data\nlegacy/logs=apps/logs\n")
+
+	mapping, err := loadNameMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nameMap{"legacy/data": "apps/data", "legacy/logs": "apps/logs"}
+	if !reflect.DeepEqual(mapping, want) {
+		t.Errorf("got %v, want %v", mapping, want)
+	}
+	if got := mapping.target("legacy/data"); got != "apps/data" {
+		t.Errorf("got target %q, want apps/data", got)
+	}
+	if got := mapping.target("default/other"); got != "default/other" {
+		t.Errorf("got target %q for an unmapped pvc, want its own key", got)
+	}
+	if !mapping.isTarget("apps/logs") || mapping.isTarget("legacy/logs") {
+		t.Error("isTarget doesn't tell the destinations apart")
+	}
+}
+
+func TestLoadNameMapInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"no destination", "legacy/data\n", `names.txt:1: "legacy/data" isn't of the form`},
+		{"no namespace", "data=apps/data\n", `names.txt:1: "data=apps/data" isn't of the form`},
+		{"nested name", "legacy/data=apps/data/x\n", `isn't of the form`},
+		{"mapped twice", "legacy/data=apps/data\nlegacy/data=apps/other\n", "names.txt:2: legacy/data is mapped more than once"},
+		{"same destination", "legacy/data=apps/data\nold/data=apps/data\n", "names.txt:2: legacy/data and old/data are both mapped to apps/data"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadNameMap(nameMapFile(t, test.content))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetPVCsAndCreateVPCRenamed(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	s.nameMapping = nameMap{"legacy/data": "apps/data"}
+	client := fake.NewSimpleClientset(
+		testPVC("apps", "data", withStorageClass("efs-target")),
+		testPVC("apps", "other", withStorageClass("efs-target")),
+	)
+
+	selection, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: "^legacy$", PvcIncludeNameRegex: ".*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvcs, err := s.getPVCs(context.Background(), client, "target", "efs-target", selection, s.nameMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(pvcs), []string{"apps/data"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got target pvcs %v, want the mapped %v", got, want)
+	}
+
+	client = fake.NewSimpleClientset()
+	if got, err := s.createVPC(context.Background(), client, nil, "efs-target", false, "legacy/data", *testPVC("legacy", "data", withStorageClass("efs-sc"))); err != nil || got != "apps/data" {
+		t.Errorf("got target pvc %s, %v, want apps/data", got, err)
+	}
+	if _, err := client.CoreV1().PersistentVolumeClaims("apps").Get(context.Background(), "data", metav1.GetOptions{}); err != nil {
+		t.Errorf("renamed pvc not created: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package synchronizer
+
+import (
+	"strings"
+	"sync"
+)
+
+// rsyncOutputTailLines is the number of lines of rsync's output kept to
+// explain its failures.
+const rsyncOutputTailLines = 20
+
+// outputTail is an io.Writer keeping the last lines written to it and, when
+// streaming, printing every line as it comes, after prefix. It can be written
+// to concurrently, as by a command's stdout and stderr. The files rsync
+// reports as deleted are all kept, and its --stats figures parsed. The lines
+// are printed by s.
+type outputTail struct {
+	s       *Synchronizer
+	mu      sync.Mutex
+	prefix  string
+	stream  bool
+	max     int
+	lines   []string
+	partial string
+	deletes []string
+	stats   rsyncStats
+}
+
+func (s *Synchronizer) newOutputTail(prefix string, stream bool, max int) *outputTail {
+	return &outputTail{s: s, prefix: prefix, stream: stream, max: max}
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := strings.Split(t.partial+string(p), "\n")
+	t.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		t.add(strings.TrimRight(line, "\r"))
+	}
+	return len(p), nil
+}
+
+func (t *outputTail) add(line string) {
+	if t.stream {
+		t.s.printLine(t.prefix + line)
+	}
+	if strings.HasPrefix(line, deletedPrefix) {
+		t.deletes = append(t.deletes, strings.TrimSpace(strings.TrimPrefix(line, deletedPrefix)))
+	}
+	t.stats.parseLine(line)
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// String returns the last lines written, an incomplete last line included.
+func (t *outputTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := t.lines
+	if t.partial != "" {
+		lines = append(lines[:len(lines):len(lines)], t.partial)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deleted returns every file rsync reported as deleted, not only the last
+// lines.
+func (t *outputTail) deleted() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.deletes...)
+}
+
+// rsyncStats returns the figures of rsync --stats written so far.
+func (t *outputTail) rsyncStats() rsyncStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
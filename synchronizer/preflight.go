@@ -0,0 +1,37 @@
+package synchronizer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// requiredBinaries returns the external commands the run needs: --rsyncBinary,
+// and --mountBinary and umount unless every file system is already mounted.
+func requiredBinaries(opts *Opts) []string {
+	binaries := []string{opts.RsyncBinary}
+	if opts.SourceMountPath == "" || len(opts.TargetMountPath) < len(opts.TargetEKSContext) || opts.StorageClassFromPV {
+		binaries = append(binaries, opts.MountBinary, "umount")
+	}
+	return binaries
+}
+
+// checkBinaries fails fast, before any cluster is contacted, when a command
+// of requiredBinaries isn't found in the PATH. It is skipped when the
+// commands are run by a CommandRunner.
+func (s *Synchronizer) checkBinaries(opts *Opts) error {
+	if s.Runner != nil || opts.ExportManifests != "" {
+		return nil
+	}
+	missing := make([]string, 0)
+	for _, binary := range requiredBinaries(opts) {
+		if _, err := exec.LookPath(binary); err != nil {
+			missing = append(missing, binary)
+		}
+	}
+	if len(missing) > 0 {
+		return configError("Missing required commands", fmt.Errorf("%s not found in PATH %s: install them, e.g. the rsync and nfs-utils packages, add their dir to the PATH, or point --rsyncBinary or --mountBinary at them", strings.Join(missing, ", "), os.Getenv("PATH")))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package synchronizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequiredBinaries(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want []string
+	}{
+		{"mounted by the run", Opts{RsyncBinary: "rsync", MountBinary: "mount", TargetEKSContext: []string{"target"}}, []string{"rsync", "mount", "umount"}},
+		{"already mounted", Opts{RsyncBinary: "rsync", MountBinary: "mount", TargetEKSContext: []string{"target"}, SourceMountPath: "/mnt/source", TargetMountPath: []string{"/mnt/target"}}, []string{"rsync"}},
+		{"other binaries", Opts{RsyncBinary: "/opt/rsync/bin/rsync", MountBinary: "mount.efs", TargetEKSContext: []string{"target"}}, []string{"/opt/rsync/bin/rsync", "mount.efs", "umount"}},
+		{"a target to mount", Opts{RsyncBinary: "rsync", MountBinary: "mount", TargetEKSContext: []string{"prod", "dr"}, SourceMountPath: "/mnt/source", TargetMountPath: []string{"/mnt/prod"}}, []string{"rsync", "mount", "umount"}},
+		{"file systems from the pvs", Opts{RsyncBinary: "rsync", MountBinary: "mount", TargetEKSContext: []string{"target"}, SourceMountPath: "/mnt/source", TargetMountPath: []string{"/mnt/target"}, StorageClassFromPV: true}, []string{"rsync", "mount", "umount"}},
+	}
+	for _, test := range tests {
+		if got := requiredBinaries(&test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckBinaries(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	t.Setenv("PATH", t.TempDir())
+	o := &Opts{RsyncBinary: "rsync", MountBinary: "mount", TargetEKSContext: []string{"target"}}
+
+	err := s.checkBinaries(o)
+	if ExitCode(err) != exitConfig || !strings.Contains(err.Error(), "rsync, mount, umount not found") {
+		t.Errorf("got %v, want the missing commands named", err)
+	}
+	fakeCommand(t, "rsync", 0)
+	fakeCommand(t, "mount", 0)
+	fakeCommand(t, "umount", 0)
+	if err := s.checkBinaries(o); err != nil {
+		t.Errorf("got %v with the commands in the PATH, want none", err)
+	}
+}
+
+func TestCheckBinariesSkipped(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	t.Setenv("PATH", t.TempDir())
+	if err := s.checkBinaries(&Opts{ExportManifests: "manifests"}); err != nil {
+		t.Errorf("got %v with --exportManifests, want none", err)
+	}
+	s, _, _ = testFakeRunner(t, &Opts{})
+	if err := s.checkBinaries(&Opts{}); err != nil {
+		t.Errorf("got %v with a CommandRunner, want none", err)
+	}
+}
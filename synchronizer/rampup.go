@@ -0,0 +1,84 @@
+package synchronizer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rampUp caps the number of volumes rsynced at the same time, raising the cap
+// from 1 to max over duration, counted from the first rsync, so that a big
+// migration doesn't load the file systems with all its rsyncs at once. With
+// a duration of 0, max rsyncs run right away.
+type rampUp struct {
+	mu       sync.Mutex
+	max      int
+	duration time.Duration
+	start    time.Time
+	running  int
+	released chan struct{}
+	now      func() time.Time
+	after    func(time.Duration) <-chan time.Time
+}
+
+func newRampUp(max int, duration time.Duration) *rampUp {
+	return &rampUp{max: max, duration: duration, released: make(chan struct{}, 1), now: time.Now, after: time.After}
+}
+
+// limit returns the number of rsyncs allowed at the same time, elapsed after
+// the first one started.
+func (r *rampUp) limit(elapsed time.Duration) int {
+	if r.max <= 1 || r.duration <= 0 || elapsed >= r.duration {
+		return r.max
+	}
+	return 1 + int(int64(r.max-1)*int64(elapsed)/int64(r.duration))
+}
+
+// nextStep returns the time elapsed after the first rsync when the limit
+// rises above limit.
+func (r *rampUp) nextStep(limit int) time.Duration {
+	steps := int64(r.max - 1)
+	return time.Duration((int64(limit)*int64(r.duration) + steps - 1) / steps)
+}
+
+// acquire blocks until one more rsync is allowed, because one finished or
+// the limit rose, and counts it as running until release. It returns the
+// error of ctx when ctx is done first.
+func (r *rampUp) acquire(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.start.IsZero() {
+		r.start = r.now()
+	}
+	for {
+		elapsed := r.now().Sub(r.start)
+		limit := r.limit(elapsed)
+		if r.running < limit {
+			r.running++
+			return nil
+		}
+		var rises <-chan time.Time
+		if limit < r.max {
+			rises = r.after(r.nextStep(limit) - elapsed)
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.released:
+		case <-rises:
+		case <-ctx.Done():
+			r.mu.Lock()
+			return ctx.Err()
+		}
+		r.mu.Lock()
+	}
+}
+
+func (r *rampUp) release() {
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	select {
+	case r.released <- struct{}{}:
+	default:
+	}
+}
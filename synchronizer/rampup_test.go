@@ -0,0 +1,137 @@
+package synchronizer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock moved by the test. The waits of after are sent to
+// waits, and end when the test sends on fire.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC), waits: make(chan time.Duration, 1), fire: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	c.fire <- now
+}
+
+func fakeRampUp(max int, duration time.Duration) (*rampUp, *fakeClock) {
+	clock := newFakeClock()
+	r := newRampUp(max, duration)
+	r.now, r.after = clock.Now, clock.After
+	return r, clock
+}
+
+func TestRampUpLimit(t *testing.T) {
+	r := newRampUp(4, 3*time.Minute)
+	tests := []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 1},
+		{59 * time.Second, 1},
+		{time.Minute, 2},
+		{2 * time.Minute, 3},
+		{3 * time.Minute, 4},
+		{time.Hour, 4},
+	}
+	for _, test := range tests {
+		if got := r.limit(test.elapsed); got != test.want {
+			t.Errorf("after %s: got %d, want %d", test.elapsed, got, test.want)
+		}
+	}
+	if got := newRampUp(4, 0).limit(0); got != 4 {
+		t.Errorf("got %d without ramp-up, want 4", got)
+	}
+}
+
+func TestRampUpWorkersIncreaseOverTime(t *testing.T) {
+	r, clock := fakeRampUp(3, 2*time.Minute)
+	acquired := make(chan struct{})
+	acquire := func() {
+		r.acquire(context.Background())
+		acquired <- struct{}{}
+	}
+
+	go acquire()
+	<-acquired
+	go acquire()
+	if wait := <-clock.waits; wait != time.Minute {
+		t.Errorf("got a wait of %s with 1 worker, want 1m0s", wait)
+	}
+	select {
+	case <-acquired:
+		t.Fatal("acquired 2 workers at the start")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.advance(time.Minute)
+	<-acquired
+	go acquire()
+	if wait := <-clock.waits; wait != time.Minute {
+		t.Errorf("got a wait of %s with 2 workers, want 1m0s", wait)
+	}
+	clock.advance(time.Minute)
+	<-acquired
+	if r.running != 3 {
+		t.Errorf("got %d workers after the ramp-up, want 3", r.running)
+	}
+}
+
+func TestRampUpRelease(t *testing.T) {
+	r, clock := fakeRampUp(3, time.Hour)
+	r.acquire(context.Background())
+
+	acquired := make(chan struct{})
+	go func() {
+		r.acquire(context.Background())
+		close(acquired)
+	}()
+	<-clock.waits
+	r.release()
+	<-acquired
+	if r.running != 1 {
+		t.Errorf("got %d workers, want the released one replaced", r.running)
+	}
+}
+
+func TestRampUpCancelled(t *testing.T) {
+	r, clock := fakeRampUp(3, time.Hour)
+	r.acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() { acquired <- r.acquire(ctx) }()
+	<-clock.waits
+	cancel()
+	if err := <-acquired; err != context.Canceled {
+		t.Errorf("got %v, want the cancellation", err)
+	}
+	if r.running != 1 {
+		t.Errorf("got %d workers, want the cancelled one not counted", r.running)
+	}
+}
@@ -0,0 +1,61 @@
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// rsyncPartialTransferExitCode is rsync's "partial transfer due to error".
+const rsyncPartialTransferExitCode = 23
+
+// sourceWritingRsyncFlags would make rsync modify the source, which is
+// mounted read-only.
+var sourceWritingRsyncFlags = []string{"--remove-source-files", "--remove-sent-files"}
+
+// checkRsyncArgsKeepSource returns an error if rsyncArgs would make rsync write to the
+// source.
+func checkRsyncArgsKeepSource(rsyncArgs string) error {
+	for _, arg := range splitArgs(rsyncArgs) {
+		for _, flag := range sourceWritingRsyncFlags {
+			if arg == flag {
+				return configError("parse error", fmt.Errorf("%s isn't allowed in --rsyncArgs, the source is mounted read-only", flag))
+			}
+		}
+	}
+	return nil
+}
+
+// isReadOnlySourceWarning tells whether an rsync failure only comes from
+// rsync trying to change files under the read-only dirSource, which doesn't
+// affect the copy made on the target.
+func isReadOnlySourceWarning(err error, output, dirSource string) bool {
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) || exitError.ExitCode() != rsyncPartialTransferExitCode {
+		return false
+	}
+	readOnlyErrors := 0
+	for _, line := range strings.Split(rsyncErrors(output), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, "Read-only file system") || !strings.Contains(line, dirSource) {
+			return false
+		}
+		readOnlyErrors++
+	}
+	return readOnlyErrors > 0
+}
+
+// rsyncErrors returns the lines of the output of rsync with its errors, the
+// ones starting with rsync:.
+func rsyncErrors(output string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "rsync:") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,57 @@
+package synchronizer
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestCheckRsyncArgsKeepSource(t *testing.T) {
+	if err := checkRsyncArgsKeepSource("-a --delete"); err != nil {
+		t.Errorf("got %v, want none", err)
+	}
+	for _, rsyncArgs := range []string{"-a --remove-source-files", "--remove-sent-files"} {
+		if err := checkRsyncArgsKeepSource(rsyncArgs); ExitCode(err) != exitConfig {
+			t.Errorf("got %v for %q, want a config error", err, rsyncArgs)
+		}
+	}
+}
+
+// commandExitError returns the error of a command exiting with code.
+func commandExitError(t *testing.T, code int) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("got %v, want an exit error", err)
+	}
+	return err
+}
+
+func TestIsReadOnlySourceWarning(t *testing.T) {
+	readOnly := `sending incremental file list
+rsync: failed to set times on "/tmp/source-fs-1/pv-1/.": Read-only file system (30)
+rsync: failed to set times on "/tmp/source-fs-1/pv-1/data": Read-only file system (30)
+rsync error: some files/attrs were not transferred (see previous errors) (code 23)`
+	targetFull := `rsync: write failed on "/tmp/target-fs-2/pv-1/data": No space left on device (28)
+rsync: failed to set times on "/tmp/source-fs-1/pv-1/.": Read-only file system (30)`
+	tests := []struct {
+		name   string
+		err    error
+		output string
+		want   bool
+	}{
+		{"read-only source", commandExitError(t, 23), readOnly, true},
+		{"other errors", commandExitError(t, 23), targetFull, false},
+		{"other source", commandExitError(t, 23), `rsync: failed to set times on "/tmp/other/.": Read-only file system (30)`, false},
+		{"no rsync error", commandExitError(t, 23), "sending incremental file list", false},
+		{"other exit code", commandExitError(t, 12), readOnly, false},
+		{"not an exit", errors.New("killed"), readOnly, false},
+	}
+	for _, test := range tests {
+		if got := isReadOnlySourceWarning(test.err, test.output, "/tmp/source-fs-1/pv-1/"); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package synchronizer
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SyncReport is the machine-readable summary of a run written by
+// --reportFile.
+type SyncReport struct {
+	mu       sync.Mutex
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	DryRun   bool            `json:"dryRun"`
+	ExitCode int             `json:"exitCode"`
+	Error    string          `json:"error,omitempty"`
+	Source   ClusterReport   `json:"source"`
+	Targets  []*TargetReport `json:"targets"`
+}
+
+// ClusterReport is a cluster and the number of pvcs found there that match
+// the selection.
+type ClusterReport struct {
+	Context    string `json:"context"`
+	Discovered int    `json:"discovered"`
+}
+
+// TargetReport is what happened on a target: the pvcs created there, among
+// which the ones recreated by --onImmutableConflict, the volumes rsynced and
+// the ones skipped.
+type TargetReport struct {
+	ClusterReport
+	Created   []string        `json:"created"`
+	Recreated []string        `json:"recreated"`
+	Volumes   []VolumeReport  `json:"volumes"`
+	Skipped   []SkippedVolume `json:"skipped"`
+}
+
+// VolumeReport is the outcome of rsyncing the volume of a source pvc: whether
+// its target pvc was created by this run rather than already existing, the
+// bytes requested by the pvc and, from rsync --stats, the bytes it
+// transferred, the number of files it considered and the ones it transferred,
+// and the throughput in MB/s of the transfer.
+type VolumeReport struct {
+	PVC              string  `json:"pvc"`
+	Synced           bool    `json:"synced"`
+	Created          bool    `json:"created"`
+	DurationSeconds  float64 `json:"durationSeconds"`
+	RequestedBytes   int64   `json:"requestedBytes"`
+	TransferredBytes int64   `json:"transferredBytes"`
+	Files            int64   `json:"files"`
+	TransferredFiles int64   `json:"transferredFiles"`
+	ThroughputMBps   float64 `json:"throughputMBps"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// SkippedVolume is a source pvc whose volume wasn't rsynced, and why.
+type SkippedVolume struct {
+	PVC    string `json:"pvc"`
+	Reason string `json:"reason"`
+}
+
+// source records the pvcs discovered on the source cluster.
+func (r *SyncReport) source(context string, discovered int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Source = ClusterReport{Context: context, Discovered: discovered}
+}
+
+// target returns the report of the target context, adding it the first time.
+// r.mu must be held.
+func (r *SyncReport) target(context string) *TargetReport {
+	for _, target := range r.Targets {
+		if target.Context == context {
+			return target
+		}
+	}
+	target := &TargetReport{ClusterReport: ClusterReport{Context: context}, Created: []string{}, Recreated: []string{}, Volumes: []VolumeReport{}, Skipped: []SkippedVolume{}}
+	r.Targets = append(r.Targets, target)
+	return target
+}
+
+// discovered records the pvcs discovered on the target context.
+func (r *SyncReport) discovered(context string, discovered int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.target(context).Discovered = discovered
+}
+
+// created records the pvcs created on the target context.
+func (r *SyncReport) created(context string, pvcs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target := r.target(context)
+	target.Created = append(target.Created, pvcs...)
+}
+
+// recreated records the pvcs deleted on the target context to be created
+// again.
+func (r *SyncReport) recreated(context string, pvcs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target := r.target(context)
+	target.Recreated = append(target.Recreated, pvcs...)
+}
+
+// skip records that the volume of the source pvc wasn't rsynced to the target
+// context.
+func (r *SyncReport) skip(context, pvc, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target := r.target(context)
+	target.Skipped = append(target.Skipped, SkippedVolume{PVC: pvc, Reason: reason})
+}
+
+// volume records the outcome of rsyncing a volume to the target context,
+// replacing the one of a previous --phaseRetries attempt.
+func (r *SyncReport) volume(context string, result volumeResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target := r.target(context)
+	volume := VolumeReport{PVC: result.pvc, Synced: result.err == nil, Created: result.created, DurationSeconds: result.duration.Seconds(), RequestedBytes: result.size, TransferredBytes: result.stats.transferredBytes, Files: result.stats.files, TransferredFiles: result.stats.transferredFiles, ThroughputMBps: result.throughput()}
+	if result.err != nil {
+		volume.Error = result.err.Error()
+	}
+	for i := range target.Volumes {
+		if target.Volumes[i].PVC == result.pvc {
+			target.Volumes[i] = volume
+			return
+		}
+	}
+	target.Volumes = append(target.Volumes, volume)
+}
+
+// transferred sums the rsync stats of the volumes of every target.
+func (r *SyncReport) transferred() rsyncStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stats rsyncStats
+	for _, target := range r.Targets {
+		for _, volume := range target.Volumes {
+			stats.add(rsyncStats{files: volume.Files, transferredBytes: volume.TransferredBytes})
+		}
+	}
+	return stats
+}
+
+// writeReport writes the report of the run ended by err, as JSON, to path or
+// to the standard output when path is -.
+func (s *Synchronizer) writeReport(path string, err error) error {
+	s.report.mu.Lock()
+	defer s.report.mu.Unlock()
+	s.finishReport(err)
+	out, err := json.MarshalIndent(s.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		s.printLine(string(out))
+		return nil
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o644)
+}
+
+// finishReport completes the report with the run ending with err, its
+// volumes sorted by pvc. The report must be locked.
+func (s *Synchronizer) finishReport(err error) {
+	s.report.Start = s.startTime
+	s.report.End = time.Now()
+	s.report.DryRun = s.Opts.DryRun
+	s.report.ExitCode = ExitCode(err)
+	if err != nil {
+		s.report.Error = err.Error()
+	}
+	for _, target := range s.report.Targets {
+		sort.Slice(target.Volumes, func(i, j int) bool { return target.Volumes[i].PVC < target.Volumes[j].PVC })
+	}
+}
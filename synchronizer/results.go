@@ -0,0 +1,94 @@
+package synchronizer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// volumeResult is the outcome of rsyncing one volume.
+type volumeResult struct {
+	pvc      string
+	size     int64
+	err      error
+	duration time.Duration
+	stats    rsyncStats
+	// created is set when the target pvc was created by this run rather
+	// than already existing.
+	created bool
+}
+
+// logSummary logs the outcome of every volume rsynced to targetContext,
+// sorted by pvc, with the throughput of the ones synchronized outside of
+// dry-run, the number that succeeded and failed, split between the target
+// pvcs created by this run and the ones that already existed, and the bytes
+// rsync transferred.
+func (s *Synchronizer) logSummary(targetContext string, results []volumeResult) {
+	sort.Slice(results, func(i, j int) bool { return results[i].pvc < results[j].pvc })
+	failed, created := 0, 0
+	var transferred rsyncStats
+	for _, result := range results {
+		transferred.add(result.stats)
+		duration := result.duration.Round(time.Second)
+		if result.created {
+			created++
+		}
+		if result.err != nil {
+			failed++
+			s.log(fmt.Sprintf("summary: %s (%s) failed after %s: %s", result.pvc, result.targetPVC(), duration, result.err))
+		} else if s.Opts.DryRun {
+			s.log(fmt.Sprintf("summary: %s (%s) synchronized in %s, %s", result.pvc, result.targetPVC(), duration, s.transferredSummary(result.stats)))
+		} else {
+			s.log(fmt.Sprintf("summary: %s (%s) synchronized in %s, %s at %.2f MB/s", result.pvc, result.targetPVC(), duration, s.transferredSummary(result.stats), result.throughput()))
+		}
+	}
+	s.log(fmt.Sprintf("summary: %d volumes synchronized to %s, %d failed, %d to created pvcs and %d to existing ones, %s",
+		len(results)-failed, targetContext, failed, created, len(results)-created, s.transferredSummary(transferred)))
+}
+
+// throughput is the rate, in MB/s, at which rsync transferred the bytes of
+// the volume over the wall-clock duration of its rsync, 0 when it took no
+// time.
+func (r volumeResult) throughput() float64 {
+	if r.duration <= 0 {
+		return 0
+	}
+	return float64(r.stats.transferredBytes) / 1e6 / r.duration.Seconds()
+}
+
+// targetPVC tells whether the target pvc was created by this run or already
+// existed.
+func (r volumeResult) targetPVC() string {
+	if r.created {
+		return "created pvc"
+	}
+	return "existing pvc"
+}
+
+// transferredSummary describes the bytes and files of stats, which in
+// dry-run rsync only would have transferred.
+func (s *Synchronizer) transferredSummary(stats rsyncStats) string {
+	verb := "transferred"
+	if s.Opts.DryRun {
+		verb = "to transfer"
+	}
+	return fmt.Sprintf("%s %s in %d out of %d files", bytesQuantity(uint64(stats.transferredBytes)), verb, stats.transferredFiles, stats.files)
+}
+
+// progressReport sums up the volumes rsynced so far out of total: how many
+// failed and the size, from their PVC requests, of the ones synchronized.
+func progressReport(results []volumeResult, total int) string {
+	failed := 0
+	var size int64
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		} else {
+			size += result.size
+		}
+	}
+	return fmt.Sprintf("progress: %d/%d volumes done, %d errors, %s synchronized",
+		len(results), total, failed, resource.NewQuantity(size, resource.BinarySI).String())
+}
@@ -0,0 +1,144 @@
+package synchronizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProgressReport(t *testing.T) {
+	results := []volumeResult{
+		{pvc: "default/a", size: 1 << 30},
+		{pvc: "default/b", size: 2 << 30, err: errors.New("rsync exited with 23")},
+		{pvc: "default/c", size: 512 << 20},
+	}
+	if got, want := progressReport(results, 10), "progress: 3/10 volumes done, 1 errors, 1536Mi synchronized"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := progressReport(nil, 10), "progress: 0/10 volumes done, 0 errors, 0 synchronized"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTargetPVC(t *testing.T) {
+	if got := (volumeResult{created: true}).targetPVC(); got != "created pvc" {
+		t.Errorf("got %q, want created pvc", got)
+	}
+	if got := (volumeResult{}).targetPVC(); got != "existing pvc" {
+		t.Errorf("got %q, want existing pvc", got)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	output := captureOutput(t, s, func() {
+		s.logSummary("target", []volumeResult{
+			{pvc: "default/b", err: errors.New("rsync exited with 23")},
+			{pvc: "default/a", created: true, duration: 2 * time.Second, stats: rsyncStats{files: 3, transferredFiles: 2, transferredBytes: 3 << 20}},
+			{pvc: "default/c", stats: rsyncStats{files: 1, transferredFiles: 1, transferredBytes: 1024}},
+		})
+	})
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	want := []string{
+		"summary: default/a (created pvc) synchronized in 2s, 3Mi transferred in 2 out of 3 files at 1.57 MB/s",
+		"summary: default/b (existing pvc) failed after 0s: rsync exited with 23",
+		"summary: default/c (existing pvc) synchronized in 0s, 1Ki transferred in 1 out of 1 files at 0.00 MB/s",
+		"summary: 2 volumes synchronized to target, 1 failed, 1 to created pvcs and 2 to existing ones, 3073Ki transferred in 3 out of 4 files",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got output:\n%s", output)
+	}
+	for i := range want {
+		if !strings.HasSuffix(lines[i], want[i]) {
+			t.Errorf("got %q, want it to end with %q", lines[i], want[i])
+		}
+	}
+}
+
+func TestLogSummaryDryRun(t *testing.T) {
+	s := testSynchronizer(t, Opts{DryRun: true})
+	output := captureOutput(t, s, func() {
+		s.logSummary("target", []volumeResult{{pvc: "default/a", duration: time.Second, stats: rsyncStats{files: 3, transferredFiles: 2, transferredBytes: 2048}}})
+	})
+	if want := "summary: default/a (existing pvc) synchronized in 1s, 2Ki to transfer in 2 out of 3 files\n"; !strings.Contains(output, want) {
+		t.Errorf("got output:\n%s\nwant %q without throughput", output, want)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		duration time.Duration
+		want     float64
+	}{
+		{10e6, 2 * time.Second, 5},
+		{1500e6, time.Minute, 25},
+		{3e6, 1500 * time.Millisecond, 2},
+		{0, time.Second, 0},
+		{10e6, 0, 0},
+	}
+	for _, test := range tests {
+		result := volumeResult{duration: test.duration, stats: rsyncStats{transferredBytes: test.bytes}}
+		if got := result.throughput(); got != test.want {
+			t.Errorf("%d bytes in %s: got %g MB/s, want %g", test.bytes, test.duration, got, test.want)
+		}
+	}
+}
+
+func TestRunSummaryCreatedPVCs(t *testing.T) {
+	existing, missing := testPVC("default", "existing", withStorageClass("efs-sc")), testPVC("default", "missing", withStorageClass("efs-sc"))
+	source, target := testClusters(existing, missing)
+	bindTargets(t, target, existing)
+	target.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// the pvc is bound as soon as it is created, as by the EFS CSI driver
+		pvc := action.(k8stesting.CreateAction).GetObject().(*v1.PersistentVolumeClaim)
+		pvc.Spec.VolumeName = "target-pv-" + pvc.Name
+		pvc.Status.Phase = v1.ClaimBound
+		return false, nil, target.Tracker().Add(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: pvc.Spec.VolumeName}})
+	})
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	fakeRsync(t, "", "", 0)
+
+	logs, err := runSynchronizer(context.Background(), t, testRunOpts(t, "--reportFile="+reportFile, "--bindWaitInterval=10ms"), source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"summary: default/existing (existing pvc) synchronized",
+		"summary: default/missing (created pvc) synchronized",
+		"1 to created pvcs and 1 to existing ones",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("%q not logged, got logs:\n%s", want, logs)
+		}
+	}
+	content, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written SyncReport
+	if err := json.Unmarshal(content, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Targets) != 1 || len(written.Targets[0].Volumes) != 2 {
+		t.Fatalf("got report %s", content)
+	}
+	volumes := written.Targets[0].Volumes
+	if volumes[0].PVC != "default/existing" || volumes[0].Created || volumes[1].PVC != "default/missing" || !volumes[1].Created {
+		t.Errorf("got volumes %+v, want default/missing only created", volumes)
+	}
+	if want := []string{"default/missing"}; !reflect.DeepEqual(written.Targets[0].Created, want) {
+		t.Errorf("got created %v, want %v", written.Targets[0].Created, want)
+	}
+}
@@ -0,0 +1,90 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// rsyncHelpOptions are the options listed by rsync --help. Lines look like
+// " -v, --verbose   increase verbosity" in rsync 3.1 and like
+// "--verbose, -v   increase verbosity" since 3.2.
+type rsyncHelpOptions struct {
+	short          map[rune]bool
+	shortWithValue map[rune]bool
+	long           map[string]bool
+}
+
+func parseRsyncHelp(help string) rsyncHelpOptions {
+	options := rsyncHelpOptions{
+		short:          make(map[rune]bool),
+		shortWithValue: make(map[rune]bool),
+		long:           make(map[string]bool),
+	}
+	for _, line := range strings.Split(help, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "-") {
+			continue
+		}
+		column, _, _ := strings.Cut(line, "  ")
+		short := make([]rune, 0, 1)
+		takesValue := false
+		for _, item := range strings.Split(column, ",") {
+			item = strings.TrimSpace(item)
+			switch {
+			case strings.HasPrefix(item, "--"):
+				name, _, hasValue := strings.Cut(strings.TrimPrefix(item, "--"), "=")
+				options.long[name] = true
+				takesValue = takesValue || hasValue
+			case len(item) == 2 && item[0] == '-':
+				short = append(short, rune(item[1]))
+			}
+		}
+		for _, flag := range short {
+			options.short[flag] = true
+			options.shortWithValue[flag] = takesValue
+		}
+	}
+	return options
+}
+
+// unknownFlags returns the flags of args that rsync doesn't know about.
+func (options rsyncHelpOptions) unknownFlags(args []string) []string {
+	unknown := make([]string, 0)
+	for _, arg := range args {
+		switch {
+		case arg == "" || arg == "-" || arg == "--" || !strings.HasPrefix(arg, "-"):
+			continue
+		case strings.HasPrefix(arg, "--"):
+			name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			if !options.long[name] && !options.long[strings.TrimPrefix(name, "no-")] {
+				unknown = append(unknown, arg)
+			}
+		default:
+			for _, flag := range arg[1:] {
+				if !options.short[flag] {
+					unknown = append(unknown, "-"+string(flag))
+					break
+				}
+				if options.shortWithValue[flag] {
+					break
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// checkRsyncArgs warns about rsync arguments unknown to the installed rsync,
+// so typos show up before any volume is synchronized.
+func (s *Synchronizer) checkRsyncArgs(ctx context.Context, rsyncArgs string) {
+	output, err := s.commandRunner(ctx).Run(s.Opts.RsyncBinary, "--help")
+	if len(output) == 0 && err != nil {
+		s.warn(fmt.Sprintf("Couldn't validate rsync arguments: %s", withHint(err)))
+		return
+	}
+	unknown := parseRsyncHelp(string(output)).unknownFlags(splitArgs(rsyncArgs))
+	if len(unknown) > 0 {
+		s.warn(fmt.Sprintf("rsync doesn't know the arguments %s of --rsyncArgs", strings.Join(unknown, " ")))
+	}
+}
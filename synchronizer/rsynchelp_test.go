@@ -0,0 +1,44 @@
+package synchronizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownFlags(t *testing.T) {
+	helps := map[string]string{
+		"rsync 3.1": ` -v, --verbose               increase verbosity
+ -a, --archive               archive mode; equals -rlptgoD (no -H,-A,-X)
+ -r, --recursive             recurse into directories
+ -e, --rsh=COMMAND           specify the remote shell to use
+     --delete                delete extraneous files from dest dirs
+     --exclude=PATTERN       exclude files matching PATTERN`,
+		"rsync 3.2": `--verbose, -v            increase verbosity
+--archive, -a            archive mode is -rlptgoD (no -A,-X,-U,-N,-H)
+--recursive, -r          recurse into directories
+--rsh=COMMAND, -e        specify the remote shell to use
+--delete                 delete extraneous files from dest dirs
+--exclude=PATTERN        exclude files matching PATTERN`,
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"known", []string{"-avr", "--delete", "--exclude=*.tmp", "--no-recursive"}, []string{}},
+		{"value of a short flag", []string{"-essh -x"}, []string{}},
+		{"unknown long", []string{"-a", "--frobnicate", "--frob=1"}, []string{"--frobnicate", "--frob=1"}},
+		{"unknown short", []string{"-avZ", "-Q"}, []string{"-Z", "-Q"}},
+		{"operands", []string{"-", "--", "/src/", "/dst/"}, []string{}},
+	}
+	for version, help := range helps {
+		options := parseRsyncHelp(help)
+		for _, test := range tests {
+			t.Run(version+" "+test.name, func(t *testing.T) {
+				if got := options.unknownFlags(test.args); !reflect.DeepEqual(got, test.want) {
+					t.Errorf("got %q, want %q", got, test.want)
+				}
+			})
+		}
+	}
+}
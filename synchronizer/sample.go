@@ -0,0 +1,79 @@
+package synchronizer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// writeEntries walks dir in lexical order and writes to w, one per line, the
+// paths relative to dir of the entries rsync is to copy from a --files-from
+// list: files, symlinks, devices, special files and empty dirs, the other
+// dirs being implied by their entries. At most n entries are written when n
+// is more than 0 and, unless cutoff is zero, only the ones last modified
+// before it. Entries removed from the live volume during the walk are
+// skipped. It returns the number of entries left out by cutoff.
+func writeEntries(w io.Writer, dir string, n int, cutoff time.Time) (int, error) {
+	written, excluded := 0, 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n > 0 && written >= n {
+			return fs.SkipAll
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if empty, err := isEmptyDir(path); err != nil || !empty {
+				return err
+			}
+		}
+		if !cutoff.IsZero() && info.ModTime().After(cutoff) {
+			excluded++
+			return nil
+		}
+		written++
+		_, err = io.WriteString(w, relative+"\n")
+		return err
+	})
+	return excluded, err
+}
+
+// writeFileList writes the entries of dir selected by writeEntries to a
+// temporary file suitable for rsync's --files-from, as they are found so that
+// big volumes aren't listed in memory. It returns the path of the file and
+// the number of entries left out by cutoff.
+func writeFileList(dir string, n int, cutoff time.Time) (string, int, error) {
+	f, err := os.CreateTemp("", "eks-volume-synchronizer-files-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	buffered := bufio.NewWriter(f)
+	excluded, err := writeEntries(buffered, dir, n, cutoff)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	return f.Name(), excluded, nil
+}
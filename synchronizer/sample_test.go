@@ -0,0 +1,139 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// sampleTree creates under a new dir a few files, an empty dir, a symlink
+// and a named pipe, and returns it along with a time after their creation but
+// before the last modification of new.txt.
+func sampleTree(t *testing.T) (string, time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range []string{"a/1.txt", "a/2.txt", "new.txt", "z.txt"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a/1.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "pipe"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Now().Add(time.Minute)
+	modified := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "new.txt"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return dir, cutoff
+}
+
+func TestWriteEntries(t *testing.T) {
+	dir, cutoff := sampleTree(t)
+	tests := []struct {
+		name         string
+		n            int
+		cutoff       time.Time
+		want         []string
+		wantExcluded int
+	}{
+		{"all", 0, time.Time{}, []string{"a/1.txt", "a/2.txt", "empty", "link", "new.txt", "pipe", "z.txt"}, 0},
+		{"sample", 3, time.Time{}, []string{"a/1.txt", "a/2.txt", "empty"}, 0},
+		{"cutoff", 0, cutoff, []string{"a/1.txt", "a/2.txt", "empty", "link", "pipe", "z.txt"}, 1},
+		{"sample and cutoff", 5, cutoff, []string{"a/1.txt", "a/2.txt", "empty", "link", "pipe"}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var list bytes.Buffer
+			excluded, err := writeEntries(&list, dir, test.n, test.cutoff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Fields(list.String()); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if excluded != test.wantExcluded {
+				t.Errorf("got %d excluded, want %d", excluded, test.wantExcluded)
+			}
+		})
+	}
+}
+
+// removingWriter removes path once the first entry is written, as if it was
+// deleted from a live volume during the walk.
+type removingWriter struct {
+	list bytes.Buffer
+	path string
+}
+
+func (w *removingWriter) Write(p []byte) (int, error) {
+	os.RemoveAll(w.path)
+	return w.list.Write(p)
+}
+
+func TestWriteEntriesSkipsRemovedFiles(t *testing.T) {
+	dir, cutoff := sampleTree(t)
+	list := &removingWriter{path: filepath.Join(dir, "z.txt")}
+
+	if _, err := writeEntries(list, dir, 0, cutoff); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(list.list.String(), "z.txt") {
+		t.Errorf("removed file listed:\n%s", list.list.String())
+	}
+}
+
+func TestWriteFileList(t *testing.T) {
+	dir, cutoff := sampleTree(t)
+
+	path, excluded, err := writeFileList(dir, 0, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a/1.txt\na/2.txt\nempty\nlink\npipe\nz.txt\n"; string(content) != want || excluded != 1 {
+		t.Errorf("got %q with %d excluded, want %q with 1 excluded", content, excluded, want)
+	}
+}
+
+func TestRsyncDirSampleFiles(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true, RsyncBinary: "rsync", SampleFiles: 2})
+	calls := fakeCommand(t, "rsync", 0)
+	dir, _ := sampleTree(t)
+
+	if _, err := s.rsyncDir(context.Background(), dir+"/", t.TempDir()+"/", "-a", 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	got := fakeCalls(t, calls)
+	if len(got) != 1 {
+		t.Fatalf("got commands %q, want one rsync", got)
+	}
+	args := strings.Fields(got[0])
+	filesFrom, ok := strings.CutPrefix(args[1], "--files-from=")
+	if !ok {
+		t.Fatalf("got rsync %q, want rsync -a --files-from=...", got[0])
+	}
+	if _, err := os.Stat(filesFrom); !os.IsNotExist(err) {
+		t.Errorf("file list %s left behind", filesFrom)
+	}
+}
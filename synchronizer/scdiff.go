@@ -0,0 +1,83 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// layoutParameters are the EFS CSI storage class parameters that decide
+// where and how the data of a volume is laid out on the file system: when
+// they differ, the target directories of the volumes don't match the source
+// ones.
+var layoutParameters = map[string]bool{
+	"basePath":              true,
+	"subPathPattern":        true,
+	"ensureUniqueDirectory": true,
+	"provisioningMode":      true,
+	"directoryPerms":        true,
+	"uid":                   true,
+	"gid":                   true,
+	"gidRangeStart":         true,
+	"gidRangeEnd":           true,
+}
+
+// diffParameters returns a line per parameter of source or target, sorted by
+// key: "  key: value" when both are the same, "~ key: source -> target" when
+// they differ, and "! key: source -> target" when they differ on a
+// parameter of layoutParameters. A missing parameter shows as "-".
+func diffParameters(source, target map[string]string) []string {
+	keys := make([]string, 0, len(source)+len(target))
+	for key := range source {
+		keys = append(keys, key)
+	}
+	for key := range target {
+		if _, ok := source[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		sourceValue, sourceOk := source[key]
+		targetValue, targetOk := target[key]
+		if !sourceOk {
+			sourceValue = "-"
+		}
+		if !targetOk {
+			targetValue = "-"
+		}
+		switch {
+		case sourceOk == targetOk && sourceValue == targetValue:
+			lines = append(lines, fmt.Sprintf("  %s: %s", key, sourceValue))
+		case layoutParameters[key]:
+			lines = append(lines, fmt.Sprintf("! %s: %s -> %s", key, sourceValue, targetValue))
+		default:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", key, sourceValue, targetValue))
+		}
+	}
+	return lines
+}
+
+// printStorageClassDiffs prints the diff of the parameters of the source
+// storage class against the one of every target.
+func (s *Synchronizer) printStorageClassDiffs(ctx context.Context, sourceContext, sourceStorageClass string, sourceParameters map[string]string, targets []*target) error {
+	for _, target := range targets {
+		targetParameters, err := s.getStorageClassParameters(ctx, target.client, target.context, target.storageClass)
+		if err != nil {
+			return err
+		}
+		s.printLine(fmt.Sprintf("--- storage class %s on %s", sourceStorageClass, sourceContext))
+		s.printLine(fmt.Sprintf("+++ storage class %s on %s", target.storageClass, target.context))
+		layoutDiffers := false
+		for _, line := range diffParameters(sourceParameters, targetParameters) {
+			layoutDiffers = layoutDiffers || line[0] == '!'
+			s.printLine(line)
+		}
+		if layoutDiffers {
+			s.warn(fmt.Sprintf("Parameters marked with ! change where the volumes are laid out on the EFS of %s", target.context))
+		}
+	}
+	return nil
+}
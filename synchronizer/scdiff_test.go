@@ -0,0 +1,78 @@
+package synchronizer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffParameters(t *testing.T) {
+	tests := []struct {
+		name           string
+		source, target map[string]string
+		want           []string
+	}{
+		{"none", nil, nil, []string{}},
+		{
+			"same",
+			map[string]string{"fileSystemId": "fs-1", "basePath": "/data"},
+			map[string]string{"fileSystemId": "fs-1", "basePath": "/data"},
+			[]string{"  basePath: /data", "  fileSystemId: fs-1"},
+		},
+		{
+			"different",
+			map[string]string{"fileSystemId": "fs-1", "basePath": "/data"},
+			map[string]string{"fileSystemId": "fs-2", "basePath": "/volumes"},
+			[]string{"! basePath: /data -> /volumes", "~ fileSystemId: fs-1 -> fs-2"},
+		},
+		{
+			"missing",
+			map[string]string{"uid": "1000", "az": "eu-west-1a"},
+			map[string]string{"gid": "1000"},
+			[]string{"~ az: eu-west-1a -> -", "! gid: - -> 1000", "! uid: 1000 -> -"},
+		},
+	}
+	for _, test := range tests {
+		if got := diffParameters(test.source, test.target); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPrintStorageClassDiffs(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	client := fake.NewSimpleClientset(&storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "efs-target"},
+		Parameters: map[string]string{"fileSystemId": "fs-2", "basePath": "/volumes"},
+	})
+	targets := []*target{{context: "target", storageClass: "efs-target", client: client}}
+
+	var err error
+	logs := captureOutput(t, s, func() {
+		err = s.printStorageClassDiffs(context.Background(), "source", "efs-sc", map[string]string{"fileSystemId": "fs-1", "basePath": "/data"}, targets)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"--- storage class efs-sc on source",
+		"+++ storage class efs-target on target",
+		"! basePath: /data -> /volumes",
+		"~ fileSystemId: fs-1 -> fs-2",
+		"WARN - Parameters marked with ! change where the volumes are laid out on the EFS of target",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("%q not printed, got:\n%s", want, logs)
+		}
+	}
+
+	targets[0].storageClass = "missing"
+	if err := s.printStorageClassDiffs(context.Background(), "source", "efs-sc", nil, targets); ExitCode(err) != exitCluster {
+		t.Errorf("got %v for a missing storage class, want a cluster error", err)
+	}
+}
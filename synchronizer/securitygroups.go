@@ -0,0 +1,231 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/efs"
+	efstypes "github.com/aws/aws-sdk-go-v2/service/efs/types"
+)
+
+// nfsPort is the port the EFS mount targets serve NFS on.
+const nfsPort = 2049
+
+// imdsTimeout bounds the requests to the EC2 instance metadata, which don't
+// get an answer outside of EC2.
+const imdsTimeout = 5 * time.Second
+
+// checkMountTargetSecurityGroups warns when the security groups of the mount
+// targets of the file systems of f, the ones their DNS name resolves to from
+// here, don't seem to let this host in on NFS: no inbound rule allows TCP
+// 2049 from its IP nor from one of its security groups, read from the EC2
+// instance metadata. It is a preflight, so it only warns when the check
+// itself fails.
+func (s *Synchronizer) checkMountTargetSecurityGroups(ctx context.Context, region, awsProfile string, f *fileSystems) error {
+	if f.mountPath != "" {
+		return nil
+	}
+	if region == "" {
+		return configError("parse error", errors.New("--validateEFSMountTargetSecurityGroup needs --region"))
+	}
+	awsConfig, err := s.loadAWSConfig(ctx, region, awsProfile)
+	if err != nil {
+		return err
+	}
+	hostGroups, err := hostSecurityGroups(ctx, awsConfig)
+	if err != nil {
+		s.log("Couldn't read the security groups of this host from the EC2 instance metadata, checking its IP only: " + err.Error())
+	}
+	for _, fileSystemId := range f.fileSystemIds() {
+		dnsName := f.efsDNSName
+		if fileSystemId != f.fileSystemId {
+			if dnsName, err = efsDNSNameFor(f.efsDNSName, fileSystemId); err != nil {
+				s.warn(fmt.Sprintf("Couldn't check the security groups of %s: %s", fileSystemId, err))
+				continue
+			}
+		}
+		problems, err := s.nfsAccessProblems(ctx, awsConfig, fileSystemId, dnsName, hostGroups)
+		if err != nil {
+			s.warn(fmt.Sprintf("Couldn't check the security groups of the mount targets of %s: %s", fileSystemId, s.cancelled(ctx, err)))
+			continue
+		}
+		for _, problem := range problems {
+			s.warn(problem)
+		}
+		if len(problems) == 0 {
+			s.log(fmt.Sprintf("the security groups of the mount targets of %s allow NFS from this host", fileSystemId))
+		}
+	}
+	return nil
+}
+
+// nfsAccessProblems describes the mount targets of fileSystemId whose
+// security groups don't allow NFS from this host. Only the mount targets
+// dnsName resolves to are checked, or all of them when it doesn't resolve.
+func (s *Synchronizer) nfsAccessProblems(ctx context.Context, awsConfig aws.Config, fileSystemId, dnsName string, hostGroups []string) ([]string, error) {
+	efsClient := efs.NewFromConfig(awsConfig)
+	ec2Client := ec2.NewFromConfig(awsConfig)
+	apiCtx, cancel := s.apiContext(ctx)
+	mountTargets, err := efsClient.DescribeMountTargets(apiCtx, &efs.DescribeMountTargetsInput{FileSystemId: aws.String(fileSystemId)})
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	problems := make([]string, 0)
+	for _, mountTarget := range resolvedMountTargets(ctx, mountTargets.MountTargets, dnsName) {
+		mountTargetId, ipAddress := aws.ToString(mountTarget.MountTargetId), aws.ToString(mountTarget.IpAddress)
+		groupIds, securityGroups, err := s.mountTargetSecurityGroups(ctx, efsClient, ec2Client, mountTarget.MountTargetId)
+		if err != nil {
+			return nil, err
+		}
+		hostIP, err := localIPTo(ipAddress)
+		if err != nil {
+			return nil, err
+		}
+		if !allowsNFS(securityGroups, hostIP, hostGroups) {
+			problems = append(problems, fmt.Sprintf("The security groups %s of mount target %s (%s) of %s don't allow NFS (TCP %d) from this host, at %s with the security groups %s: mounting will likely time out",
+				strings.Join(groupIds, ", "), mountTargetId, ipAddress, fileSystemId, nfsPort, hostIP, strings.Join(hostGroups, ", ")))
+		}
+	}
+	return problems, nil
+}
+
+// mountTargetSecurityGroups returns the ids and the rules of the security
+// groups of the mount target mountTargetId, each call bounded by its own
+// --apiTimeout.
+func (s *Synchronizer) mountTargetSecurityGroups(ctx context.Context, efsClient *efs.Client, ec2Client *ec2.Client, mountTargetId *string) ([]string, []ec2types.SecurityGroup, error) {
+	apiCtx, cancel := s.apiContext(ctx)
+	groups, err := efsClient.DescribeMountTargetSecurityGroups(apiCtx, &efs.DescribeMountTargetSecurityGroupsInput{MountTargetId: mountTargetId})
+	cancel()
+	if err != nil {
+		return nil, nil, err
+	}
+	apiCtx, cancel = s.apiContext(ctx)
+	securityGroups, err := ec2Client.DescribeSecurityGroups(apiCtx, &ec2.DescribeSecurityGroupsInput{GroupIds: groups.SecurityGroups})
+	cancel()
+	if err != nil {
+		return nil, nil, err
+	}
+	return groups.SecurityGroups, securityGroups.SecurityGroups, nil
+}
+
+// resolvedMountTargets returns the mount targets dnsName resolves to, all of
+// them when none is found.
+func resolvedMountTargets(ctx context.Context, mountTargets []efstypes.MountTargetDescription, dnsName string) []efstypes.MountTargetDescription {
+	addresses, err := net.DefaultResolver.LookupHost(ctx, dnsName)
+	if err != nil {
+		return mountTargets
+	}
+	resolved := make([]efstypes.MountTargetDescription, 0)
+	for _, mountTarget := range mountTargets {
+		for _, address := range addresses {
+			if aws.ToString(mountTarget.IpAddress) == address {
+				resolved = append(resolved, mountTarget)
+			}
+		}
+	}
+	if len(resolved) == 0 {
+		return mountTargets
+	}
+	return resolved
+}
+
+// allowsNFS tells whether an inbound rule of groups allows TCP nfsPort from
+// hostIP or from one of hostGroups. A rule from a prefix list, which isn't
+// resolved, is assumed to allow it.
+func allowsNFS(groups []ec2types.SecurityGroup, hostIP net.IP, hostGroups []string) bool {
+	for _, group := range groups {
+		for _, permission := range group.IpPermissions {
+			if !allowsNFSPort(permission) {
+				continue
+			}
+			if len(permission.PrefixListIds) > 0 {
+				return true
+			}
+			for _, ipRange := range permission.IpRanges {
+				if cidrContains(aws.ToString(ipRange.CidrIp), hostIP) {
+					return true
+				}
+			}
+			for _, ipRange := range permission.Ipv6Ranges {
+				if cidrContains(aws.ToString(ipRange.CidrIpv6), hostIP) {
+					return true
+				}
+			}
+			for _, pair := range permission.UserIdGroupPairs {
+				for _, hostGroup := range hostGroups {
+					if aws.ToString(pair.GroupId) == hostGroup {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// allowsNFSPort tells whether permission covers TCP nfsPort.
+func allowsNFSPort(permission ec2types.IpPermission) bool {
+	switch aws.ToString(permission.IpProtocol) {
+	case "-1":
+		return true
+	case "tcp", "6":
+		return aws.ToInt32(permission.FromPort) <= nfsPort && nfsPort <= aws.ToInt32(permission.ToPort)
+	}
+	return false
+}
+
+func cidrContains(cidr string, ip net.IP) bool {
+	_, network, err := net.ParseCIDR(cidr)
+	return err == nil && network.Contains(ip)
+}
+
+// localIPTo returns the IP this host connects to address from. Dialing UDP
+// doesn't send anything.
+func localIPTo(address string) (net.IP, error) {
+	connection, err := net.Dial("udp", net.JoinHostPort(address, fmt.Sprint(nfsPort)))
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+	return connection.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// hostSecurityGroups returns, sorted, the security groups of the primary
+// network interface of this EC2 instance.
+func hostSecurityGroups(ctx context.Context, awsConfig aws.Config) ([]string, error) {
+	client := imds.NewFromConfig(awsConfig)
+	apiCtx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+	mac, err := instanceMetadata(apiCtx, client, "mac")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := instanceMetadata(apiCtx, client, "network/interfaces/macs/"+mac+"/security-group-ids")
+	if err != nil {
+		return nil, err
+	}
+	hostGroups := strings.Fields(groups)
+	sort.Strings(hostGroups)
+	return hostGroups, nil
+}
+
+func instanceMetadata(ctx context.Context, client *imds.Client, path string) (string, error) {
+	output, err := client.GetMetadata(ctx, &imds.GetMetadataInput{Path: path})
+	if err != nil {
+		return "", err
+	}
+	defer output.Content.Close()
+	content, err := io.ReadAll(output.Content)
+	return strings.TrimSpace(string(content)), err
+}
@@ -0,0 +1,121 @@
+package synchronizer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	efstypes "github.com/aws/aws-sdk-go-v2/service/efs/types"
+)
+
+func nfsRule(protocol string, from, to int32) ec2types.IpPermission {
+	return ec2types.IpPermission{IpProtocol: aws.String(protocol), FromPort: aws.Int32(from), ToPort: aws.Int32(to)}
+}
+
+func TestAllowsNFSPort(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission ec2types.IpPermission
+		want       bool
+	}{
+		{"nfs", nfsRule("tcp", 2049, 2049), true},
+		{"range", nfsRule("tcp", 1024, 65535), true},
+		{"protocol number", nfsRule("6", 2049, 2049), true},
+		{"all traffic", ec2types.IpPermission{IpProtocol: aws.String("-1")}, true},
+		{"other port", nfsRule("tcp", 22, 22), false},
+		{"udp", nfsRule("udp", 2049, 2049), false},
+	}
+	for _, test := range tests {
+		if got := allowsNFSPort(test.permission); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCidrContains(t *testing.T) {
+	tests := []struct {
+		cidr string
+		ip   string
+		want bool
+	}{
+		{"10.0.0.0/16", "10.0.3.4", true},
+		{"10.0.0.0/16", "10.1.3.4", false},
+		{"10.0.3.4/32", "10.0.3.4", true},
+		{"0.0.0.0/0", "192.168.1.1", true},
+		{"2001:db8::/32", "2001:db8::1", true},
+		{"2001:db8::/32", "10.0.3.4", false},
+		{"not a cidr", "10.0.3.4", false},
+	}
+	for _, test := range tests {
+		if got := cidrContains(test.cidr, net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("cidrContains(%s, %s): got %t, want %t", test.cidr, test.ip, got, test.want)
+		}
+	}
+}
+
+func TestAllowsNFS(t *testing.T) {
+	hostIP := net.ParseIP("10.0.3.4")
+	withCIDR := func(rule ec2types.IpPermission, cidr string) ec2types.IpPermission {
+		rule.IpRanges = []ec2types.IpRange{{CidrIp: aws.String(cidr)}}
+		return rule
+	}
+	fromGroup := nfsRule("tcp", 2049, 2049)
+	fromGroup.UserIdGroupPairs = []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-nodes")}}
+	fromPrefixList := nfsRule("tcp", 2049, 2049)
+	fromPrefixList.PrefixListIds = []ec2types.PrefixListId{{PrefixListId: aws.String("pl-1")}}
+	tests := []struct {
+		name       string
+		rules      []ec2types.IpPermission
+		hostGroups []string
+		want       bool
+	}{
+		{"no rules", nil, nil, false},
+		{"from the vpc", []ec2types.IpPermission{withCIDR(nfsRule("tcp", 2049, 2049), "10.0.0.0/16")}, nil, true},
+		{"from another subnet", []ec2types.IpPermission{withCIDR(nfsRule("tcp", 2049, 2049), "10.1.0.0/16")}, nil, false},
+		{"other port from the vpc", []ec2types.IpPermission{withCIDR(nfsRule("tcp", 22, 22), "10.0.0.0/16")}, nil, false},
+		{"from a host group", []ec2types.IpPermission{fromGroup}, []string{"sg-bastion", "sg-nodes"}, true},
+		{"from another group", []ec2types.IpPermission{fromGroup}, []string{"sg-bastion"}, false},
+		{"from a prefix list", []ec2types.IpPermission{fromPrefixList}, nil, true},
+	}
+	for _, test := range tests {
+		groups := []ec2types.SecurityGroup{{GroupId: aws.String("sg-efs"), IpPermissions: test.rules}}
+		if got := allowsNFS(groups, hostIP, test.hostGroups); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckMountTargetSecurityGroupsArgs(t *testing.T) {
+	s, _, _ := testFakeRunner(t, &Opts{})
+	if err := s.checkMountTargetSecurityGroups(context.Background(), "", "", &fileSystems{mountPath: "/mnt/efs"}); err != nil {
+		t.Errorf("got %v with --sourceMountPath, want the check skipped", err)
+	}
+	if err := s.checkMountTargetSecurityGroups(context.Background(), "", "", &fileSystems{efsDNSName: "fs-1.efs.eu-west-1.amazonaws.com"}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v without --region, want a config error", err)
+	}
+}
+
+func TestResolvedMountTargets(t *testing.T) {
+	mountTargets := []efstypes.MountTargetDescription{
+		{MountTargetId: aws.String("fsmt-1"), IpAddress: aws.String("127.0.0.1")},
+		{MountTargetId: aws.String("fsmt-2"), IpAddress: aws.String("10.0.3.4")},
+	}
+	if got := resolvedMountTargets(context.Background(), mountTargets, "127.0.0.1"); len(got) != 1 || aws.ToString(got[0].MountTargetId) != "fsmt-1" {
+		t.Errorf("got %d mount targets, want fsmt-1 only", len(got))
+	}
+	if got := resolvedMountTargets(context.Background(), mountTargets, "192.0.2.1"); len(got) != 2 {
+		t.Errorf("got %d mount targets for an unknown address, want all of them", len(got))
+	}
+}
+
+func TestLocalIPTo(t *testing.T) {
+	ip, err := localIPTo("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IsLoopback() {
+		t.Errorf("got %s, want a loopback address", ip)
+	}
+}
@@ -0,0 +1,330 @@
+package synchronizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	selectionpkg "k8s.io/apimachinery/pkg/selection"
+)
+
+// serverPVCFields are the fields the API server can select pvcs by.
+var serverPVCFields = map[string]bool{"metadata.name": true, "metadata.namespace": true}
+
+// clientPVCFields are the fields of --pvcFieldSelector the API server doesn't
+// select pvcs by, which are matched here instead.
+var clientPVCFields = map[string]func(v1.PersistentVolumeClaim) string{
+	"status.phase": func(pvc v1.PersistentVolumeClaim) string { return string(pvc.Status.Phase) },
+}
+
+// pvcSelection holds the compiled --pvcInclude* and --pvcExclude* regexes,
+// the exclude ones being nil when empty, and --pvcLabelSelector, which is
+// left to the API server. --pvcFieldSelector is split between fieldSelector,
+// left to the API server, and clientFields, matched here. listed holds the
+// keys of --pvcListFile and of the failed volumes of --retryFailedFrom, those
+// listed by both with the two, nil without them.
+type pvcSelection struct {
+	labelSelector    string
+	fieldSelector    string
+	clientFields     fields.Selector
+	includeNamespace *regexp.Regexp
+	includeName      *regexp.Regexp
+	excludeNamespace *regexp.Regexp
+	excludeName      *regexp.Regexp
+	listed           map[string]bool
+}
+
+// newPVCSelection compiles the selection regexes of opts, returning an error
+// naming the flag of an invalid one.
+func newPVCSelection(opts *Opts) (*pvcSelection, error) {
+	var err error
+	selection := &pvcSelection{}
+	if selection.includeNamespace, err = compileRegex("pvcIncludeNamespaceRegex", opts.PvcIncludeNamespaceRegex); err != nil {
+		return nil, err
+	}
+	if selection.includeName, err = compileRegex("pvcIncludeNameRegex", opts.PvcIncludeNameRegex); err != nil {
+		return nil, err
+	}
+	if opts.PvcExcludeNamespaceRegex != "" {
+		if selection.excludeNamespace, err = compileRegex("pvcExcludeNamespaceRegex", opts.PvcExcludeNamespaceRegex); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PvcExcludeNameRegex != "" {
+		if selection.excludeName, err = compileRegex("pvcExcludeNameRegex", opts.PvcExcludeNameRegex); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PvcLabelSelector != "" {
+		if _, err := labels.Parse(opts.PvcLabelSelector); err != nil {
+			return nil, configError(fmt.Sprintf("Invalid --pvcLabelSelector %q", opts.PvcLabelSelector), err)
+		}
+		selection.labelSelector = opts.PvcLabelSelector
+	}
+	if opts.PvcFieldSelector != "" {
+		if selection.fieldSelector, selection.clientFields, err = splitFieldSelector(opts.PvcFieldSelector); err != nil {
+			return nil, configError(fmt.Sprintf("Invalid --pvcFieldSelector %q", opts.PvcFieldSelector), err)
+		}
+	}
+	if opts.PvcListFile != "" {
+		if selection.listed, err = loadPVCList(opts.PvcListFile); err != nil {
+			return nil, configError("Couldn't load pvc list "+opts.PvcListFile, err)
+		}
+	}
+	if opts.RetryFailedFrom != "" {
+		failed, err := loadFailedPVCs(opts.RetryFailedFrom)
+		if err != nil {
+			return nil, configError("Couldn't load the failed volumes of report "+opts.RetryFailedFrom, err)
+		}
+		if selection.listed != nil {
+			for key := range failed {
+				if !selection.listed[key] {
+					delete(failed, key)
+				}
+			}
+		}
+		selection.listed = failed
+	}
+	return selection, nil
+}
+
+// loadFailedPVCs reads the report written by --reportFile at path and returns
+// the keys (namespace/name) of the source pvcs whose volume failed to be
+// rsynced to any target.
+func loadFailedPVCs(path string) (map[string]bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report SyncReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, err
+	}
+	failed := make(map[string]bool)
+	for _, target := range report.Targets {
+		for _, volume := range target.Volumes {
+			if !volume.Synced {
+				failed[volume.PVC] = true
+			}
+		}
+	}
+	return failed, nil
+}
+
+// loadPVCList reads the keys (namespace/name) listed in path, one per line,
+// as written by writePendingManifest. Empty lines and lines starting with #
+// are ignored.
+func loadPVCList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isPVCKey(line) {
+			return nil, fmt.Errorf("%s:%d: %q isn't of the form namespace/name", path, lineNumber, line)
+		}
+		listed[line] = true
+	}
+	return listed, scanner.Err()
+}
+
+// splitFieldSelector parses a field selector on pvcs into the one the API
+// server supports and the one left to match here, returning an error on a
+// field pvcs can't be selected by.
+func splitFieldSelector(fieldSelector string) (string, fields.Selector, error) {
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return "", nil, err
+	}
+	server := make([]fields.Selector, 0)
+	client := make([]fields.Selector, 0)
+	for _, requirement := range selector.Requirements() {
+		var term fields.Selector
+		switch requirement.Operator {
+		case selectionpkg.Equals, selectionpkg.DoubleEquals:
+			term = fields.OneTermEqualSelector(requirement.Field, requirement.Value)
+		case selectionpkg.NotEquals:
+			term = fields.OneTermNotEqualSelector(requirement.Field, requirement.Value)
+		default:
+			return "", nil, fmt.Errorf("unsupported operator %s", requirement.Operator)
+		}
+		if serverPVCFields[requirement.Field] {
+			server = append(server, term)
+		} else if clientPVCFields[requirement.Field] != nil {
+			client = append(client, term)
+		} else {
+			return "", nil, fmt.Errorf("pvcs can't be selected by field %s, only by metadata.name, metadata.namespace and status.phase", requirement.Field)
+		}
+	}
+	var clientFields fields.Selector
+	if len(client) > 0 {
+		clientFields = fields.AndSelectors(client...)
+	}
+	if len(server) == 0 {
+		return "", clientFields, nil
+	}
+	return fields.AndSelectors(server...).String(), clientFields, nil
+}
+
+// withoutFields returns the selection without --pvcFieldSelector, for the
+// target pvcs, which are listed whatever their phase, so that unbound ones
+// aren't created again.
+func (s *pvcSelection) withoutFields() *pvcSelection {
+	selection := *s
+	selection.fieldSelector = ""
+	selection.clientFields = nil
+	return &selection
+}
+
+// matchesFields tells whether pvc matches the fields of --pvcFieldSelector
+// the API server doesn't select pvcs by.
+func (s *pvcSelection) matchesFields(pvc v1.PersistentVolumeClaim) bool {
+	if s.clientFields == nil {
+		return true
+	}
+	set := fields.Set{}
+	for field, value := range clientPVCFields {
+		set[field] = value(pvc)
+	}
+	return s.clientFields.Matches(set)
+}
+
+func compileRegex(flag, pattern string) (*regexp.Regexp, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, configError(fmt.Sprintf("Invalid --%s %q", flag, pattern), err)
+	}
+	return compiled, nil
+}
+
+// matches tells whether the pvc name of namespace is listed, with
+// --pvcListFile or --retryFailedFrom, included and not excluded.
+func (s *pvcSelection) matches(namespace, name string) bool {
+	if s.listed != nil && !s.listed[namespace+"/"+name] {
+		return false
+	}
+	if !s.includeNamespace.MatchString(namespace) || !s.includeName.MatchString(name) {
+		return false
+	}
+	if s.excludeNamespace != nil && s.excludeNamespace.MatchString(namespace) {
+		return false
+	}
+	return s.excludeName == nil || !s.excludeName.MatchString(name)
+}
+
+// smallerTargets returns, sorted, a description of every pair of pvcs whose
+// target requests less storage than its source, which rsync would fail to
+// fill.
+func (s *Synchronizer) smallerTargets(pvcsSource, pvcsTarget map[string]v1.PersistentVolumeClaim) []string {
+	smaller := make([]string, 0)
+	for sourceIndex, sourcePVC := range pvcsSource {
+		targetPVC, ok := pvcsTarget[s.nameMapping.target(sourceIndex)]
+		if ok && volumeSize(targetPVC) < volumeSize(sourcePVC) {
+			smaller = append(smaller, s.sizeMismatch(sourceIndex, sourcePVC, targetPVC))
+		}
+	}
+	sort.Strings(smaller)
+	return smaller
+}
+
+func (s *Synchronizer) sizeMismatch(sourceIndex string, sourcePVC, targetPVC v1.PersistentVolumeClaim) string {
+	return fmt.Sprintf("target pvc %s requests %d bytes, less than the %d bytes of source pvc %s",
+		s.nameMapping.target(sourceIndex), volumeSize(targetPVC), volumeSize(sourcePVC), sourceIndex)
+}
+
+// fairOrder returns the keys of pvcs going round-robin across namespaces,
+// so that a namespace with many volumes doesn't delay all the others.
+// Within a namespace keys are sorted by name.
+func fairOrder(pvcs map[string]v1.PersistentVolumeClaim) []string {
+	byNamespace := make(map[string][]string)
+	namespaces := make([]string, 0)
+	for key, pvc := range pvcs {
+		namespace := pvc.ObjectMeta.Namespace
+		if _, ok := byNamespace[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+		byNamespace[namespace] = append(byNamespace[namespace], key)
+	}
+	sort.Strings(namespaces)
+	for _, keys := range byNamespace {
+		sort.Strings(keys)
+	}
+
+	ordered := make([]string, 0, len(pvcs))
+	for round := 0; len(ordered) < len(pvcs); round++ {
+		for _, namespace := range namespaces {
+			if round < len(byNamespace[namespace]) {
+				ordered = append(ordered, byNamespace[namespace][round])
+			}
+		}
+	}
+	return ordered
+}
+
+// limitPerNamespace keeps at most max pvcs of each namespace and returns the
+// keys of the ones left for a later run.
+func limitPerNamespace(pvcs map[string]v1.PersistentVolumeClaim, max int) (map[string]v1.PersistentVolumeClaim, []string) {
+	limited := make(map[string]v1.PersistentVolumeClaim)
+	deferred := make([]string, 0)
+	count := make(map[string]int)
+	for _, key := range fairOrder(pvcs) {
+		pvc := pvcs[key]
+		if count[pvc.ObjectMeta.Namespace] >= max {
+			deferred = append(deferred, key)
+			continue
+		}
+		count[pvc.ObjectMeta.Namespace]++
+		limited[key] = pvc
+	}
+	sort.Strings(deferred)
+	return limited, deferred
+}
+
+// writePendingManifest writes the distinct keys (namespace/name) of pending
+// pvcs to path, one per line.
+func writePendingManifest(path string, pending []string) error {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, len(pending))
+	for _, key := range pending {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var content strings.Builder
+	for _, key := range keys {
+		content.WriteString(key + "\n")
+	}
+	return os.WriteFile(path, []byte(content.String()), 0o644)
+}
+
+// withinSizeRange keeps the pvcs requesting between minSize and maxSize
+// bytes, bounds included. A zero bound isn't checked.
+func withinSizeRange(pvcs map[string]v1.PersistentVolumeClaim, minSize, maxSize int64) map[string]v1.PersistentVolumeClaim {
+	selected := make(map[string]v1.PersistentVolumeClaim)
+	for key, pvc := range pvcs {
+		size := volumeSize(pvc)
+		if (minSize > 0 && size < minSize) || (maxSize > 0 && size > maxSize) {
+			continue
+		}
+		selected[key] = pvc
+	}
+	return selected
+}
@@ -0,0 +1,321 @@
+package synchronizer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+// pvcMap returns pvcs by namespace/name.
+func pvcMap(pvcs ...*v1.PersistentVolumeClaim) map[string]v1.PersistentVolumeClaim {
+	byKey := make(map[string]v1.PersistentVolumeClaim, len(pvcs))
+	for _, pvc := range pvcs {
+		byKey[pvc.Namespace+"/"+pvc.Name] = *pvc
+	}
+	return byKey
+}
+
+func TestFairOrder(t *testing.T) {
+	pvcs := pvcMap(
+		testPVC("big", "c"), testPVC("big", "a"), testPVC("big", "b"), testPVC("big", "d"),
+		testPVC("small", "x"),
+		testPVC("apps", "z"), testPVC("apps", "y"),
+	)
+	want := []string{"apps/y", "big/a", "small/x", "apps/z", "big/b", "big/c", "big/d"}
+	if got := fairOrder(pvcs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLimitPerNamespace(t *testing.T) {
+	pvcs := pvcMap(testPVC("big", "c"), testPVC("big", "a"), testPVC("big", "b"), testPVC("small", "x"))
+
+	limited, deferred := limitPerNamespace(pvcs, 2)
+	if got, want := keys(limited), []string{"big/a", "big/b", "small/x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if want := []string{"big/c"}; !reflect.DeepEqual(deferred, want) {
+		t.Errorf("got deferred %v, want %v", deferred, want)
+	}
+}
+
+func TestWritePendingManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.txt")
+
+	if err := writePendingManifest(path, []string{"default/b", "apps/a", "default/b"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "apps/a\ndefault/b\n"; string(content) != want {
+		t.Errorf("got %q, want %q", content, want)
+	}
+}
+
+func TestPendingManifestAsPVCListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.txt")
+	if err := writePendingManifest(path, []string{"default/b", "apps/a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	selection, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", PvcListFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"default", "b", true},
+		{"apps", "a", true},
+		{"default", "a", false},
+		{"apps", "b", false},
+	}
+	for _, test := range tests {
+		if got := selection.matches(test.namespace, test.name); got != test.want {
+			t.Errorf("%s/%s: got %t, want %t", test.namespace, test.name, got, test.want)
+		}
+	}
+}
+
+func TestLoadPVCList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pvcs.txt")
+	if err := os.WriteFile(path, []byte("# left by the last run\napps/a\n\n  default/b  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := loadPVCList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"apps/a": true, "default/b": true}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("got %v, want %v", listed, want)
+	}
+
+	if err := os.WriteFile(path, []byte("apps/a\ndata\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPVCList(path); err == nil || err.Error() != path+`:2: "data" isn't of the form namespace/name` {
+		t.Errorf("got %v, want the invalid line", err)
+	}
+	if _, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", PvcListFile: path}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v, want a config error", err)
+	}
+}
+
+// sampleReport is a report, as written by --reportFile, of a run to two
+// targets.
+const sampleReport = `{
+  "exitCode": 4,
+  "error": "Couldn't rsync 1 volumes to eks-b: apps/b",
+  "targets": [
+    {
+      "context": "eks-a",
+      "volumes": [
+        {"pvc": "apps/a", "synced": true},
+        {"pvc": "default/c", "synced": false, "error": "exit status 23"}
+      ],
+      "skipped": [{"pvc": "default/d", "reason": "volume not bound"}]
+    },
+    {
+      "context": "eks-b",
+      "volumes": [
+        {"pvc": "apps/a", "synced": true},
+        {"pvc": "apps/b", "synced": false, "error": "exit status 12"}
+      ]
+    }
+  ]
+}`
+
+func TestRetryFailedFrom(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(report, []byte(sampleReport), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list := filepath.Join(dir, "pvcs.txt")
+	if err := os.WriteFile(list, []byte("apps/b\ndefault/d\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		pvcListFile string
+		want        []string
+	}{
+		{"alone", "", []string{"apps/b", "default/c"}},
+		{"with --pvcListFile", list, []string{"apps/b"}},
+	}
+	for _, test := range tests {
+		selection, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", RetryFailedFrom: report, PvcListFile: test.pvcListFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := make([]string, 0)
+		for _, key := range []string{"apps/a", "apps/b", "default/c", "default/d"} {
+			namespace, name, _ := strings.Cut(key, "/")
+			if selection.matches(namespace, name) {
+				selected = append(selected, key)
+			}
+		}
+		if !reflect.DeepEqual(selected, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, selected, test.want)
+		}
+	}
+}
+
+func TestRetryFailedFromWrittenReport(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	s.report.volume("target", volumeResult{pvc: "default/a"})
+	s.report.volume("target", volumeResult{pvc: "default/b", err: errors.New("exit status 23")})
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := s.writeReport(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := loadFailedPVCs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"default/b": true}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("got %v, want %v", failed, want)
+	}
+	if err := os.WriteFile(path, []byte("apps/a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", RetryFailedFrom: path}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v for a report that isn't JSON, want a config error", err)
+	}
+}
+
+func TestWithinSizeRange(t *testing.T) {
+	pvcs := pvcMap(
+		testPVC("default", "small", withSize("500Mi")),
+		testPVC("default", "min", withSize("1Gi")),
+		testPVC("default", "max", withSize("10Gi")),
+		testPVC("default", "big", withSize("1Ti")),
+	)
+	tests := []struct {
+		name             string
+		minSize, maxSize int64
+		want             []string
+	}{
+		{"unbounded", 0, 0, []string{"default/big", "default/max", "default/min", "default/small"}},
+		{"min", 1 << 30, 0, []string{"default/big", "default/max", "default/min"}},
+		{"max", 0, 10 << 30, []string{"default/max", "default/min", "default/small"}},
+		{"both", 1 << 30, 10 << 30, []string{"default/max", "default/min"}},
+	}
+	for _, test := range tests {
+		if got := keys(withinSizeRange(pvcs, test.minSize, test.maxSize)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSplitFieldSelector(t *testing.T) {
+	tests := []struct {
+		fieldSelector string
+		wantServer    string
+		wantClient    string
+		wantErr       bool
+	}{
+		{"metadata.name=data", "metadata.name=data", "", false},
+		{"metadata.namespace==apps,metadata.name!=cache", "metadata.name!=cache,metadata.namespace=apps", "", false},
+		{"status.phase=Bound", "", "status.phase=Bound", false},
+		{"metadata.namespace=apps,status.phase!=Pending", "metadata.namespace=apps", "status.phase!=Pending", false},
+		{"spec.volumeName=pv-1", "", "", true},
+		{"status.phase", "", "", true},
+	}
+	for _, test := range tests {
+		server, client, err := splitFieldSelector(test.fieldSelector)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %t", test.fieldSelector, err, test.wantErr)
+			continue
+		}
+		gotClient := ""
+		if client != nil {
+			gotClient = client.String()
+		}
+		if server != test.wantServer || gotClient != test.wantClient {
+			t.Errorf("%s: got %q and %q, want %q and %q", test.fieldSelector, server, gotClient, test.wantServer, test.wantClient)
+		}
+	}
+}
+
+func TestMatchesFields(t *testing.T) {
+	bound, pending := *testPVC("default", "bound"), *testPVC("default", "pending", withPhase(v1.ClaimPending))
+	tests := []struct {
+		fieldSelector string
+		wantBound     bool
+		wantPending   bool
+	}{
+		{"", true, true},
+		{"metadata.name=bound", true, true},
+		{"status.phase=Bound", true, false},
+		{"status.phase!=Bound", false, true},
+	}
+	for _, test := range tests {
+		selection, err := newPVCSelection(&Opts{PvcFieldSelector: test.fieldSelector})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := selection.matchesFields(bound); got != test.wantBound {
+			t.Errorf("%q: got %t for a bound pvc, want %t", test.fieldSelector, got, test.wantBound)
+		}
+		if got := selection.matchesFields(pending); got != test.wantPending {
+			t.Errorf("%q: got %t for a pending pvc, want %t", test.fieldSelector, got, test.wantPending)
+		}
+	}
+}
+
+func TestWithoutFields(t *testing.T) {
+	selection, err := newPVCSelection(&Opts{PvcFieldSelector: "metadata.namespace=apps,status.phase=Bound", PvcLabelSelector: "app=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	without := selection.withoutFields()
+	if without.fieldSelector != "" || without.clientFields != nil || without.labelSelector != "app=web" {
+		t.Errorf("got %+v, want only the fields left out", without)
+	}
+	if selection.fieldSelector != "metadata.namespace=apps" || selection.clientFields == nil {
+		t.Errorf("selection changed: %+v", selection)
+	}
+}
+
+func TestNewPVCSelectionInvalidFieldSelector(t *testing.T) {
+	if _, err := newPVCSelection(&Opts{PvcFieldSelector: "spec.volumeName=pv-1"}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v, want a config error", err)
+	}
+}
+
+func TestPVCSelection(t *testing.T) {
+	selection, err := newPVCSelection(&Opts{
+		PvcIncludeNamespaceRegex: "^apps-", PvcIncludeNameRegex: ".*",
+		PvcExcludeNamespaceRegex: "-test$", PvcExcludeNameRegex: "^cache-",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{"apps-shop", "data", true},
+		{"default", "data", false},
+		{"apps-test", "data", false},
+		{"apps-shop", "cache-0", false},
+	}
+	for _, test := range tests {
+		if got := selection.matches(test.namespace, test.name); got != test.want {
+			t.Errorf("%s/%s: got %t, want %t", test.namespace, test.name, got, test.want)
+		}
+	}
+	if _, err := newPVCSelection(&Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", PvcExcludeNameRegex: "("}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v for an invalid regex, want a config error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// selfTestFiles are the sample files, by path relative to the source dir,
+// rsynced by --selfTest.
+var selfTestFiles = map[string][]byte{
+	"hello.txt":              []byte("hello from eks-volume-synchronizer\n"),
+	"nested/data.bin":        bytes.Repeat([]byte{0, 1, 2, 3, 255}, 4096),
+	"nested/deeper/empty":    {},
+	"with space/and-dash.md": []byte("# sample\n"),
+}
+
+// selfTest rsyncs sample files between two temporary dirs with the rsync
+// options of the run, without any cluster nor EFS, to check that rsync and
+// the flags work in this environment.
+func (s *Synchronizer) selfTest(ctx context.Context) error {
+	s.log("self-test: rsyncing sample files between temporary dirs")
+	s.checkRsyncArgs(ctx, s.Opts.RsyncArgs)
+	if err := checkRsyncArgsKeepSource(s.Opts.RsyncArgs); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "eks-volume-synchronizer-selftest-")
+	if err != nil {
+		return configError("Self-test failed", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+
+	var size int64
+	written := s.startTime.Add(-time.Hour)
+	for name, content := range selfTestFiles {
+		path := filepath.Join(source, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return configError("Self-test failed", err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return configError("Self-test failed", err)
+		}
+		// older than the run, not to be left out by --excludeNewerThanStart
+		if err := os.Chtimes(path, written, written); err != nil {
+			return configError("Self-test failed", err)
+		}
+		size += int64(len(content))
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return configError("Self-test failed", err)
+	}
+
+	_, err = s.rsyncDir(ctx, source+string(os.PathSeparator), target+string(os.PathSeparator), s.Opts.RsyncArgs, size)
+	if err != nil {
+		return rsyncError("Self-test failed", err)
+	}
+	if s.Opts.DryRun {
+		s.log("self-test: rsync ran, nothing copied in dry-run")
+		return nil
+	}
+	if s.Opts.Snapshots {
+		target = filepath.Join(target, s.snapshotName())
+	}
+	copied, err := checkSelfTestFiles(target, s.Opts.SampleFiles == 0)
+	if err != nil {
+		return rsyncError("Self-test failed", err)
+	}
+	s.log(fmt.Sprintf("self-test passed: rsync copied %d sample files with --rsyncArgs=%s", copied, s.Opts.RsyncArgs))
+	return nil
+}
+
+// checkSelfTestFiles compares the sample files copied to target with the
+// ones written, and returns how many were copied. All of them must be unless
+// --sampleFiles only copied some.
+func checkSelfTestFiles(target string, all bool) (int, error) {
+	names := make([]string, 0, len(selfTestFiles))
+	for name := range selfTestFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	copied := 0
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(target, name))
+		if errors.Is(err, os.ErrNotExist) && !all {
+			continue
+		}
+		if err != nil {
+			return copied, err
+		}
+		if !bytes.Equal(content, selfTestFiles[name]) {
+			return copied, fmt.Errorf("%s differs after rsync", name)
+		}
+		copied++
+	}
+	return copied, nil
+}
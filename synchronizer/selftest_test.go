@@ -0,0 +1,108 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeSelfTestFiles writes the sample files of --selfTest under a new dir,
+// but the ones named in skip, and returns it.
+func writeSelfTestFiles(t *testing.T, skip ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range selfTestFiles {
+		if slices.Contains(skip, name) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCheckSelfTestFiles(t *testing.T) {
+	copied, err := checkSelfTestFiles(writeSelfTestFiles(t), true)
+	if err != nil || copied != len(selfTestFiles) {
+		t.Errorf("got %d copied and %v, want %d and nil", copied, err, len(selfTestFiles))
+	}
+
+	missing := writeSelfTestFiles(t, "hello.txt")
+	if _, err := checkSelfTestFiles(missing, true); err == nil {
+		t.Error("got nil with a missing file, want an error")
+	}
+	copied, err = checkSelfTestFiles(missing, false)
+	if err != nil || copied != len(selfTestFiles)-1 {
+		t.Errorf("got %d copied and %v with --sampleFiles, want %d and nil", copied, err, len(selfTestFiles)-1)
+	}
+
+	differing := writeSelfTestFiles(t)
+	if err := os.WriteFile(filepath.Join(differing, "hello.txt"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkSelfTestFiles(differing, true); err == nil || !strings.Contains(err.Error(), "hello.txt differs") {
+		t.Errorf("got %v, want hello.txt to differ", err)
+	}
+}
+
+// copyingCommand puts first on the PATH a command name copying the dir of
+// its next to last argument to its last one, as rsync -a would.
+func copyingCommand(t *testing.T, name string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\neval source=\\${$(($# - 1))}\neval target=\\${$#}\n[ \"$1\" = --help ] || cp -R \"$source\". \"$target\"\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSelfTest(t *testing.T) {
+	s := testSynchronizer(t, Opts{RsyncBinary: "rsync", RsyncArgs: "-a"})
+	copyingCommand(t, "rsync")
+
+	var err error
+	logs := captureOutput(t, s, func() { err = s.selfTest(context.Background()) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs, "self-test passed: rsync copied 4 sample files") {
+		t.Errorf("pass not logged, got logs:\n%s", logs)
+	}
+}
+
+func TestSelfTestFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		rsyncArgs string
+		copying   bool
+		want      int
+	}{
+		{"source-writing flag", "-a --remove-source-files", true, exitConfig},
+		{"nothing copied", "-a", false, exitRsync},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, Opts{Quiet: true, RsyncBinary: "rsync", RsyncArgs: test.rsyncArgs})
+			if test.copying {
+				copyingCommand(t, "rsync")
+			} else {
+				fakeCommand(t, "rsync", 0)
+			}
+
+			var err error
+			captureOutput(t, s, func() { err = s.selfTest(context.Background()) })
+			if ExitCode(err) != test.want {
+				t.Errorf("got %v, want exit code %d", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package synchronizer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// latestSnapshotLink is the symlink, in the target dir of a volume, to the
+// snapshot of the last successful run.
+const latestSnapshotLink = "latest"
+
+// snapshotName is the name of the dir of this run's snapshots, from the
+// time the run started, so that snapshots sort chronologically.
+func (s *Synchronizer) snapshotName() string {
+	return s.startTime.UTC().Format("2006-01-02T15-04-05Z")
+}
+
+// previousSnapshot returns the dir of the last successful snapshot under
+// dirTarget, or "" when there is none yet.
+func previousSnapshot(dirTarget string) string {
+	name, err := os.Readlink(filepath.Join(dirTarget, latestSnapshotLink))
+	if err != nil {
+		return ""
+	}
+	previous := filepath.Join(dirTarget, name)
+	if _, err := os.Stat(previous); err != nil {
+		return ""
+	}
+	return previous
+}
+
+// markLatestSnapshot points the latest link of dirTarget to the snapshot
+// name, replacing the previous link atomically.
+func markLatestSnapshot(dirTarget, name string) error {
+	link := filepath.Join(dirTarget, latestSnapshotLink)
+	temporary := link + ".tmp"
+	os.Remove(temporary)
+	if err := os.Symlink(name, temporary); err != nil {
+		return err
+	}
+	return os.Rename(temporary, link)
+}
@@ -0,0 +1,69 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotName(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	s.startTime = time.Date(2026, 10, 17, 3, 4, 5, 0, time.FixedZone("CEST", 2*60*60))
+
+	if got, want := s.snapshotName(), "2026-10-17T01-04-05Z"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if got := previousSnapshot(dir); got != "" {
+		t.Errorf("got %q without snapshots, want none", got)
+	}
+	for _, name := range []string{"2026-10-16T01-00-00Z", "2026-10-17T01-00-00Z"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := markLatestSnapshot(dir, name); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := previousSnapshot(dir), filepath.Join(dir, name); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, "2026-10-17T01-00-00Z")); err != nil {
+		t.Fatal(err)
+	}
+	if got := previousSnapshot(dir); got != "" {
+		t.Errorf("got %q for a removed snapshot, want none", got)
+	}
+}
+
+func TestRsyncDirSnapshots(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true, RsyncBinary: "rsync", Snapshots: true})
+	calls := fakeCommand(t, "rsync", 0)
+	source, target := t.TempDir()+"/", t.TempDir()+"/"
+	previous := filepath.Join(target, "2026-10-16T01-00-00Z")
+	if err := os.Mkdir(previous, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := markLatestSnapshot(target, "2026-10-16T01-00-00Z"); err != nil {
+		t.Fatal(err)
+	}
+
+	captureOutput(t, s, func() {
+		if _, err := s.rsyncDir(context.Background(), source, target, "-a", 0); err != nil {
+			t.Error(err)
+		}
+	})
+	snapshot := filepath.Join(target, s.snapshotName()) + "/"
+	want := "-a --link-dest=" + previous + " --stats " + source + " " + snapshot
+	if got := fakeCalls(t, calls); len(got) != 1 || got[0] != want {
+		t.Errorf("got rsyncs %q, want [%q]", got, want)
+	}
+	if name, err := os.Readlink(filepath.Join(target, latestSnapshotLink)); err != nil || name != s.snapshotName() {
+		t.Errorf("got latest %q, %v, want %s", name, err, s.snapshotName())
+	}
+}
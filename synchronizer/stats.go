@@ -0,0 +1,85 @@
+package synchronizer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rsyncStats holds the figures printed by rsync --stats that matter here:
+// the files considered, the ones transferred and their size.
+type rsyncStats struct {
+	files            int64
+	transferredFiles int64
+	transferredBytes int64
+}
+
+// add adds the figures of other, to aggregate the stats of several rsyncs.
+func (s *rsyncStats) add(other rsyncStats) {
+	s.files += other.files
+	s.transferredFiles += other.transferredFiles
+	s.transferredBytes += other.transferredBytes
+}
+
+// parseLine picks the figures out of a line of rsync --stats output. Lines
+// are matched on keywords stable across rsync versions, e.g. both
+// "Number of files: 1,234 (reg: 1,000, dir: 234)" of rsync 3 and
+// "Number of files: 1234" of rsync 2.6 give 1234 files, and both "Number of
+// regular files transferred: 2" of rsync 3 and "Number of files transferred:
+// 2" of rsync 2.6 give 2 transferred files. Other lines are ignored.
+func (s *rsyncStats) parseLine(line string) {
+	name, value, found := strings.Cut(line, ":")
+	if !found {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "number of files":
+		if n, ok := parseStatsNumber(value); ok {
+			s.files = n
+		}
+	case "number of regular files transferred", "number of files transferred":
+		if n, ok := parseStatsNumber(value); ok {
+			s.transferredFiles = n
+		}
+	case "total transferred file size":
+		if n, ok := parseStatsNumber(value); ok {
+			s.transferredBytes = n
+		}
+	}
+}
+
+// parseRsyncStats parses the --stats figures out of the output of rsync.
+func parseRsyncStats(output string) rsyncStats {
+	var stats rsyncStats
+	for _, line := range strings.Split(output, "\n") {
+		stats.parseLine(strings.TrimRight(line, "\r"))
+	}
+	return stats
+}
+
+// statsMultipliers are the suffixes of the numbers printed by rsync
+// --human-readable, in powers of 1000 as with a single -h.
+var statsMultipliers = map[byte]float64{'K': 1e3, 'M': 1e6, 'G': 1e9, 'T': 1e12, 'P': 1e15}
+
+// parseStatsNumber parses the first number of an rsync --stats value, with
+// its thousands separators and an optional --human-readable suffix, such as
+// "1,234 bytes" or "1.23M bytes".
+func parseStatsNumber(value string) (int64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	number := strings.ReplaceAll(fields[0], ",", "")
+	multiplier := 1.0
+	if m, ok := statsMultipliers[number[len(number)-1]]; ok {
+		multiplier = m
+		number = number[:len(number)-1]
+	}
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return int64(float64(n) * multiplier), true
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(f * multiplier), true
+}
@@ -0,0 +1,103 @@
+package synchronizer
+
+import "testing"
+
+// rsync3Stats is the output of rsync 3.2.7 -a --stats.
+const rsync3Stats = `sending incremental file list
+./
+data/
+data/a.txt
+data/b.txt
+
+Number of files: 1,234 (reg: 1,000, dir: 234)
+Number of created files: 14 (reg: 12, dir: 2)
+Number of deleted files: 0
+Number of regular files transferred: 12
+Total file size: 9,999 bytes
+Total transferred file size: 2,048 bytes
+Literal data: 2,048 bytes
+Matched data: 0 bytes
+File list size: 0
+File list generation time: 0.001 seconds
+File list transfer time: 0.000 seconds
+Total bytes sent: 3,110
+Total bytes received: 270
+
+sent 3,110 bytes  received 270 bytes  6,760.00 bytes/sec
+total size is 9,999  speedup is 2.96
+`
+
+// rsync26Stats is the output of rsync 2.6.9 -a --stats.
+const rsync26Stats = `building file list ... done
+data/a.txt
+data/b.txt
+
+Number of files: 42
+Number of files transferred: 2
+Total file size: 4096 bytes
+Total transferred file size: 512 bytes
+Literal data: 512 bytes
+Matched data: 0 bytes
+File list size: 1021
+File list generation time: 0.001 seconds
+File list transfer time: 0.000 seconds
+Total bytes sent: 1645
+Total bytes received: 64
+
+sent 1645 bytes  received 64 bytes  3418.00 bytes/sec
+total size is 4096  speedup is 2.40
+`
+
+func TestParseStatsNumber(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int64
+		wantOk bool
+	}{
+		{" 1,234 bytes", 1234, true},
+		{" 1234", 1234, true},
+		{" 1,234 (reg: 1,000, dir: 234)", 1234, true},
+		{" 1.23M bytes", 1230000, true},
+		{" 2K bytes", 2000, true},
+		{" 1.5G", 1500000000, true},
+		{"", 0, false},
+		{" many bytes", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := parseStatsNumber(test.value)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("parseStatsNumber(%q): got %d, %t, want %d, %t", test.value, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestParseRsyncStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   rsyncStats
+	}{
+		{"rsync 3", rsync3Stats, rsyncStats{files: 1234, transferredFiles: 12, transferredBytes: 2048}},
+		{"rsync 2.6", rsync26Stats, rsyncStats{files: 42, transferredFiles: 2, transferredBytes: 512}},
+		{
+			"CRLF",
+			"sending incremental file list\r\nNumber of files: 1,234 (reg: 1,000, dir: 234)\r\nNumber of regular files transferred: 12\r\nTotal transferred file size: 2,048 bytes\r\n",
+			rsyncStats{files: 1234, transferredFiles: 12, transferredBytes: 2048},
+		},
+		{"human-readable", "number of files: 1.2K\nTotal Transferred File Size: 3.5M bytes\n", rsyncStats{files: 1200, transferredBytes: 3500000}},
+		{"no stats", "rsync error: some files could not be transferred\n", rsyncStats{}},
+	}
+	for _, test := range tests {
+		if got := parseRsyncStats(test.output); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRsyncStatsAdd(t *testing.T) {
+	stats := rsyncStats{files: 1, transferredFiles: 1, transferredBytes: 10}
+	stats.add(rsyncStats{files: 2, transferredFiles: 1, transferredBytes: 20})
+	if want := (rsyncStats{files: 3, transferredFiles: 2, transferredBytes: 30}); stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
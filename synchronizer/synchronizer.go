@@ -0,0 +1,1419 @@
+package synchronizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	flags "github.com/jessevdk/go-flags"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"io/fs"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Opts struct {
+	Kubeconfig               string        `long:"kubeconfig" description:"Path to the kubeconfig file. Defaults to the KUBECONFIG list, then ~/.kube/config"`
+	SourceEKSContext         string        `long:"sourceEKSContext" description:"Name of source EKS [Elastic Kubernetes Systems] context"`
+	Context                  string        `long:"context" description:"Shorthand for --sourceEKSContext, as in kubectl"`
+	TargetEKSContext         []string      `long:"targetEKSContext" description:"Name of target EKS [Elastic Kubernetes Systems] context. Repeat to synchronize to several clusters. Required unless the target is in-cluster"`
+	InCluster                string        `long:"inCluster" description:"Side, source or target, that is the cluster this Pod runs in, reached with its service account instead of a kubeconfig context. Inside a Pod, defaults to the side without a context" choice:"source" choice:"target"`
+	AllowedTargetContexts    []string      `long:"allowedTargetContexts" description:"Glob pattern (e.g. *-staging) of the contexts allowed as target. Can be repeated. Any context is allowed when none is given" env:"VOLUME_SYNC_ALLOWED_TARGET_CONTEXTS" env-delim:","`
+	SourceEFSDNSName         string        `long:"sourceEFSDNSName" description:"Name of EFS [Elastic Filesystem] DNS of source EKS. Required unless --sourceMountPath or --region is set"`
+	TargetEFSDNSName         []string      `long:"targetEFSDNSName" description:"Name of EFS [Elastic Filesystem] DNS of target EKS. Repeat once per --targetEKSContext. Required unless --targetMountPath or --region is set"`
+	CheckSecurityGroups      bool          `long:"validateEFSMountTargetSecurityGroup" description:"Before mounting, warn when the security groups of the EFS mount targets don't seem to allow NFS from this host. Needs --region"`
+	Region                   string        `long:"region" description:"AWS region of the EFS file systems. An omitted EFS DNS name is then looked up, with the EFS API, from the fileSystemId of the storage class"`
+	SourceMountPath          string        `long:"sourceMountPath" description:"Path where the source EFS is already mounted. Skips mounting it"`
+	TargetMountPath          []string      `long:"targetMountPath" description:"Path where the target EFS is already mounted. Skips mounting it. Repeat once per --targetEKSContext"`
+	SourceMarkerFile         string        `long:"sourceMarkerFile" description:"File, relative to the root of the source EFS, that must exist after mounting it, to make sure it is the intended file system"`
+	SourceStorageClass       string        `long:"sourceStorageClass" description:"Name of source Storage Class in Kubernetes" default:"efs"`
+	TargetStorageClass       []string      `long:"targetStorageClass" description:"Name of target Storage Class in Kubernetes. Repeat once per --targetEKSContext or give it once for all of them" default:"efs"`
+	SourceAwsProfile         string        `long:"sourceAwsProfile" description:"AWS profile (AWS_PROFILE) used by the credential plugin of the source context, e.g. aws eks get-token"`
+	TargetAwsProfile         []string      `long:"targetAwsProfile" description:"AWS profile (AWS_PROFILE) used by the credential plugin of the target context. Repeat once per --targetEKSContext or give it once for all of them"`
+	SourceCAFile             string        `long:"sourceCAFile" description:"CA bundle (PEM) trusted for the API server of the source context, in addition to the one of the kubeconfig"`
+	TargetCAFile             []string      `long:"targetCAFile" description:"CA bundle (PEM) trusted for the API server of the target context, in addition to the one of the kubeconfig. Repeat once per --targetEKSContext or give it once for all of them"`
+	MountArgs                string        `long:"mountArgs" description:"Arguments to mount EFS"  default:"-t nfs4 -o nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,noresvport"`
+	RsyncArgs                string        `long:"rsyncArgs" description:"Arguments to rysnc EFS"  default:"-rulpEto"`
+	RsyncBinary              string        `long:"rsyncBinary" description:"rsync command to run, a name looked up in the PATH or a path, e.g. to a wrapper script" default:"rsync"`
+	MountBinary              string        `long:"mountBinary" description:"mount command to run, a name looked up in the PATH or a path, e.g. to the mount helper of amazon-efs-utils" default:"mount"`
+	Env                      []string      `long:"env" description:"Environment variable (KEY=VALUE) passed to the mount and rsync commands. Can be repeated"`
+	Archive                  bool          `long:"archive" description:"Use rsync's archive mode (-a, i.e. -rlptgoD) instead of the default -rulpEto. --rsyncArgs, if given, are added after -a"`
+	WholeFile                bool          `long:"wholeFile" description:"Copy whole files instead of using rsync's delta algorithm (rsync -W)"`
+	AutoStrategy             bool          `long:"autoStrategy" description:"Copy whole files (rsync -W) for volumes smaller than --autoStrategyThreshold and use rsync's delta algorithm for bigger ones"`
+	AutoStrategyThreshold    string        `long:"autoStrategyThreshold" description:"Volume size, from its PVC request, under which --autoStrategy copies whole files" default:"10Gi"`
+	IntraVolumeParallelism   int           `long:"intraVolumeParallelism" description:"Number of top-level subdirs of a volume rsynced at the same time, each by its own rsync, before a last rsync of the rest of the volume" default:"1"`
+	CheckpointLog            string        `long:"checkpointLog" description:"File recording the top-level subdirs of the volumes already rsynced: each subdir is rsynced on its own and, when a run is interrupted, the next one skips the subdirs done"`
+	Devices                  bool          `long:"devices" description:"Recreate character and block device files on the target (rsync --devices, half of -D). Needs rsync to run as root"`
+	Specials                 bool          `long:"specials" description:"Recreate special files, named pipes and sockets, on the target (rsync --specials, half of -D)"`
+	SampleFiles              int           `long:"sampleFiles" description:"Only rsync the first N files of each volume, to rehearse a migration quickly"`
+	VerifyCounts             bool          `long:"verifyCounts" description:"After rsyncing a volume, compare the number of files and dirs of the source and the target and consider the volume failed if they differ"`
+	VerifyCountsTolerance    int           `long:"verifyCountsTolerance" description:"Number of files, and of dirs, by which --verifyCounts tolerates the source and the target to differ"`
+	Snapshots                bool          `long:"snapshots" description:"Rsync each volume into a new dated dir of its target, hard-linking the files unchanged since the previous run's dir (rsync --link-dest), for backup-style snapshots"`
+	DeleteExtraneous         bool          `long:"deleteExtraneous" description:"Delete the files of the target that don't exist on the source (rsync --delete), for a true mirror. Needs a dry-run of the same command first, or --force"`
+	DeleteAfter              bool          `long:"deleteAfter" description:"With --deleteExtraneous, delete once the transfer is done instead of during it (rsync --delete-after)"`
+	Force                    bool          `long:"force" description:"Delete with --deleteExtraneous without a dry-run first, and confirm --onImmutableConflict=recreate"`
+	ExcludeNewerThanStart    bool          `long:"excludeNewerThanStart" description:"Only rsync the files last modified before the run started, so that files being written aren't copied half-written"`
+	PhaseRetries             int           `long:"phaseRetries" description:"Number of times to rsync again the volumes that failed, once all volumes were rsynced"`
+	PhaseRetryBackoff        time.Duration `long:"phaseRetryBackoff" description:"Time to wait before the first --phaseRetries, doubled before every next one" default:"30s"`
+	ExportManifests          string        `long:"exportManifests" description:"Write the target PVC manifests to this dir, as <namespace>/<name>.yaml, instead of creating them and rsyncing, e.g. to commit them for GitOps"`
+	DfProgress               bool          `long:"dfProgress" description:"Log an estimate of the progress of the rsync to each target from the bytes used on the file systems (statfs), for rsync versions without --info=progress2"`
+	DfProgressInterval       time.Duration `long:"dfProgressInterval" description:"Interval between two --dfProgress estimates" default:"1m"`
+	ReportFile               string        `long:"reportFile" description:"Write a JSON report of the run to this file, or to the standard output when -: pvcs discovered, created, synchronized and skipped"`
+	SummaryWebhook           string        `long:"summaryWebhook" description:"URL to POST the JSON report of the run to at its end, whatever the outcome, e.g. for ChatOps. Retried on network errors and 429 and 5xx responses"`
+	SummaryWebhookTemplate   string        `long:"summaryWebhookTemplate" description:"Go template of the body posted to --summaryWebhook, executed with the report, e.g. {\"text\": {{json .Error}}}. The JSON report when empty"`
+	ReportEvery              int           `long:"reportEvery" description:"Log the progress of the run (volumes done, errors, size synchronized) every N volumes rsynced"`
+	Parallelism              int           `long:"parallelism" description:"Maximum number of volumes rsynced at the same time" default:"4"`
+	RampUpDuration           time.Duration `long:"rampUpDuration" description:"Time over which the number of volumes rsynced at the same time rises from 1 to --parallelism, so that the file systems aren't loaded all at once at the start (e.g. 10m). No ramp-up when not set"`
+	MaxInFlightBytes         string        `long:"maxInFlightBytes" description:"Maximum sum of volume sizes (e.g. 500Gi) rsynced at the same time, estimated from PVC requests. Unlimited when empty"`
+	PvcIncludeNamespaceRegex string        `long:"pvcIncludeNamespaceRegex" description:"Regular expression to select namespace of PVCs to synchronize."  default:"default"`
+	PvcIncludeNameRegex      string        `long:"pvcIncludeNameRegex" description:"Regular expression to select names of PVCs to synchronize."  default:".*"`
+	PvcFieldSelector         string        `long:"pvcFieldSelector" description:"Field selector of the source pvcs, e.g. status.phase=Bound. Supports metadata.name, metadata.namespace, left to the API server, and status.phase"`
+	PvcLabelSelector         string        `long:"pvcLabelSelector" description:"Label selector of the PVCs to synchronize (e.g. app=web,tier!=cache), filtered by the API server. PVCs must match it and the regexes"`
+	PvcExcludeNamespaceRegex string        `long:"pvcExcludeNamespaceRegex" description:"Regular expression of namespaces whose PVCs aren't synchronized, even if included. Excludes nothing when empty"`
+	PvcExcludeNameRegex      string        `long:"pvcExcludeNameRegex" description:"Regular expression of names of PVCs not to synchronize, even if included. Excludes nothing when empty"`
+	HelmRelease              string        `long:"helmRelease" description:"Only synchronize the PVCs of this Helm release: labeled app.kubernetes.io/instance=<release> or created by one of its StatefulSets"`
+	MinSize                  string        `long:"minSize" description:"Only synchronize PVCs requesting at least this storage (e.g. 1Gi)"`
+	MaxSize                  string        `long:"maxSize" description:"Only synchronize PVCs requesting at most this storage (e.g. 100Gi)"`
+	NameMapFile              string        `long:"nameMapFile" description:"File of srcNamespace/srcName=dstNamespace/dstName lines renaming source PVCs on the target. PVCs not listed keep their name"`
+	StorageClassFromPV       bool          `long:"storageClassFromPV" description:"Find the EFS file system of each volume from its PV instead of from the storage class, for volumes spread across several file systems"`
+	MaxVolumesPerNamespace   int           `long:"maxVolumesPerNamespace" description:"Maximum number of volumes of each namespace synchronized by this run. The others are left for a next run"`
+	Timezone                 string        `long:"timezone" description:"Time zone (e.g. Europe/Paris) of the volume-sync/window annotations of the source PVCs" default:"Local"`
+	PvcListFile              string        `long:"pvcListFile" description:"File of the PVCs (namespace/name, one per line, e.g. a --pendingManifest) to synchronize, # starting a comment line. PVCs must be listed and match the regexes"`
+	RetryFailedFrom          string        `long:"retryFailedFrom" description:"JSON report of a previous run, written by --reportFile, whose failed volumes are the only ones to synchronize. They must match the regexes, and be in --pvcListFile if given, too"`
+	PendingManifest          string        `long:"pendingManifest" description:"File to write the PVCs (namespace/name, one per line) still pending at the end of the run: unbound, not created, failed or deferred"`
+	BindWaitInterval         time.Duration `long:"bindWaitInterval" description:"Time to wait for created PVCs to be bound before creating the missing ones again" default:"60s"`
+	BindTimeout              time.Duration `long:"bindTimeout" description:"Maximum time to wait, once the missing PVCs are created, for the target PVCs to be Bound before rsyncing. Not waited for when 0"`
+	BindMaxAttempts          int           `long:"bindMaxAttempts" description:"Maximum number of times missing PVCs are created before synchronizing" default:"10"`
+	StrictSize               bool          `long:"strictSize" description:"Fail the run, before rsyncing, when a target PVC requests less storage than its source PVC, instead of skipping it"`
+	StrictVolumeReady        bool          `long:"strictVolumeReady" description:"Fail, listing them, if source or target volumes are still unbound after waiting for the PVCs to be bound, instead of skipping them"`
+	SkipIfTargetNotEmpty     bool          `long:"skipIfTargetNotEmpty" description:"Skip PVCs whose target directory already has data"`
+	SkipForbiddenNamespaces  bool          `long:"skipForbiddenNamespaces" description:"When creating a PVC on the target is forbidden, by RBAC or a resource quota, skip the other volumes of its namespace instead of failing. They are left pending"`
+	RequeueOnConflict        int           `long:"requeueOnConflict" description:"Number of times to retry, with backoff, the creation of a PVC that fails with a conflict"`
+	EmitEvents               bool          `long:"emitEvents" description:"Record Kubernetes Events on the target PVCs when they are created and when their synchronization fails"`
+	AnnotateSource           bool          `long:"annotateSource" description:"Annotate successfully synchronized source PVCs with the target context and the time of the migration"`
+	Lock                     bool          `long:"lock" description:"Hold a Lease on each target cluster during the run so that concurrent runs against the same target refuse to start"`
+	LockNamespace            string        `long:"lockNamespace" description:"Namespace of the Lease used by --lock" default:"default"`
+	LockWait                 time.Duration `long:"lockWait" description:"How long to wait for a Lease held by another run instead of failing right away (e.g. 10m)"`
+	PreRunCommand            string        `long:"preRunCommand" description:"Shell command run once before the migration, e.g. a validation. The run is aborted if it fails"`
+	PostRunCommand           string        `long:"postRunCommand" description:"Shell command run once after the migration. Its failure is reported but doesn't fail the run"`
+	HealthAddr               string        `long:"healthAddr" description:"Address (e.g. :8080) to serve /healthz and /readyz on, for the probes of a Pod running the synchronizer"`
+	OtlpEndpoint             string        `long:"otlpEndpoint" description:"OTLP/HTTP endpoint (e.g. http://localhost:4318) to export traces of the migration to"`
+	PrintResolvedConfig      bool          `long:"printResolvedConfig" description:"Print the effective options, defaults included, and exit"`
+	AllowSameFilesystem      bool          `long:"allowSameFilesystem" description:"Allow the source and target to be the same EFS, to copy between volumes of a single file system"`
+	DiffStorageClasses       bool          `long:"diffStorageClasses" description:"Print how the parameters of the target storage classes differ from the source one, then exit"`
+	SelfTest                 bool          `long:"selfTest" description:"Rsync sample files between two temporary dirs, with the rsync options given, to check that rsync works in this environment. No cluster nor EFS is needed"`
+	OnImmutableConflict      string        `long:"onImmutableConflict" description:"What to do with an existing target pvc whose volumeMode or accessModes differ from its source, which can't be changed: skip its volume, fail, or delete and recreate it, which needs --force" choice:"skip" choice:"recreate" choice:"fail" default:"skip"`
+	BetaAnnotation           string        `long:"betaStorageClassAnnotation" description:"What to do with the deprecated volume.beta.kubernetes.io/storage-class annotation on created pvcs: strip it, keep it, or auto to strip it on targets running Kubernetes 1.24 or later" choice:"auto" choice:"keep" choice:"strip" default:"auto"`
+	DryRun                   bool          `long:"dryRun" description:"Dry-Run of configuration"`
+	Estimate                 bool          `long:"estimate" description:"Print the bytes rsync would transfer, by namespace and in total, then exit. Implies --dryRun"`
+	DryRunCreateDirs         bool          `long:"dryRunCreateDirs" hidden:"true" description:"Deprecated, dry-run always creates the mount point directories now"`
+	APITimeout               time.Duration `long:"apiTimeout" description:"Maximum duration of every Kubernetes API call. 0 for unlimited" default:"30s"`
+	Timeout                  time.Duration `long:"timeout" description:"Maximum duration of the run (e.g. 2h). Kubernetes API calls, mount and rsync commands still running then are cancelled. Unlimited when not set"`
+	Quiet                    bool          `long:"quiet" description:"Turn off verbose output"`
+}
+
+const (
+	efsProvisioner = "efs.csi.aws.com"
+	// targetSizeAnnotation on a source PVC overrides the storage requested
+	// by the PVC created on the target
+	targetSizeAnnotation = "volume-sync/target-size"
+)
+
+// Synchronizer synchronizes the volumes of the pvcs of a source cluster to
+// target clusters, as configured by Opts. Each Synchronizer holds the state
+// of its own runs, so several can run at a time in a process.
+type Synchronizer struct {
+	Opts *Opts
+	// Source and Targets are the clients of the source cluster and of the
+	// target clusters, one per Opts.TargetEKSContext. When nil, they are
+	// built from the kubeconfig contexts of Opts.
+	Source  kubernetes.Interface
+	Targets []kubernetes.Interface
+	// Logger receives the log lines and rsync's output, os.Stdout when nil.
+	Logger io.Writer
+	// Runner runs the mount, umount and rsync commands, as they are when nil.
+	Runner CommandRunner
+
+	// output is Logger, or os.Stdout, and logMutex serializes the output of
+	// the concurrent rsyncs, line by line.
+	output   io.Writer
+	logMutex sync.Mutex
+	// wg waits for the rsyncs of a target, limiter holds back the ones over
+	// --maxInFlightBytes, by the size estimated with sizeEstimate, volumeSize
+	// unless replaced.
+	wg                    sync.WaitGroup
+	limiter               *byteLimiter
+	sizeEstimate          func(v1.PersistentVolumeClaim) int64
+	autoStrategyThreshold int64
+	nameMapping           nameMap
+	startTime             time.Time
+	// checkpoints records, with --checkpointLog, the subdirs of the volumes
+	// already rsynced, nil without it.
+	checkpoints *checkpointLog
+	// report is filled along the run and written to --reportFile at its end.
+	report *SyncReport
+	// mounted records the mount paths already mounted by this run.
+	mounted map[string]bool
+}
+
+// New returns a Synchronizer configured by opts, with its clients built from
+// the kubeconfig contexts of opts and logging to os.Stdout.
+func New(opts *Opts) *Synchronizer {
+	return &Synchronizer{Opts: opts, Logger: os.Stdout}
+}
+
+// prepare sets up the state the methods of s rely on, keeping the one of a
+// previous call.
+func (s *Synchronizer) prepare() {
+	s.output = s.Logger
+	if s.output == nil {
+		s.output = os.Stdout
+	}
+	if s.startTime.IsZero() {
+		s.startTime = time.Now()
+	}
+	if s.limiter == nil {
+		s.limiter = newByteLimiter(0)
+	}
+	if s.sizeEstimate == nil {
+		s.sizeEstimate = volumeSize
+	}
+	if s.report == nil {
+		s.report = &SyncReport{}
+	}
+	if s.mounted == nil {
+		s.mounted = make(map[string]bool)
+	}
+}
+
+// Run synchronizes the volumes until ctx is done and returns the error ending
+// the run early or, after synchronizing all it could, the one of the volumes
+// that failed. With --reportFile, the report is written whatever the outcome,
+// and with --summaryWebhook it is posted.
+func (s *Synchronizer) Run(ctx context.Context) (err error) {
+	s.prepare()
+	s.startTime = time.Now()
+	s.report = &SyncReport{}
+	s.mounted = make(map[string]bool)
+	s.checkpoints = nil
+	s.nameMapping = nil
+	if s.Opts.ReportFile != "" {
+		defer func() {
+			if reportErr := s.writeReport(s.Opts.ReportFile, err); reportErr != nil {
+				s.warn("Couldn't write report " + s.Opts.ReportFile + ": " + reportErr.Error())
+			}
+		}()
+	}
+	if s.Opts.SummaryWebhook != "" {
+		defer func() {
+			if webhookErr := s.sendSummary(err); webhookErr != nil {
+				s.warn("Couldn't post the summary to " + redactURL(s.Opts.SummaryWebhook) + ": " + webhookErr.Error())
+			}
+		}()
+	}
+	return s.run(ctx)
+}
+
+// GetPVCs returns the pvcs of clientset, the cluster of the kubeconfig
+// context clusterContext, with the storage class storageClassName that match
+// the selection of Opts, keyed by namespace/name.
+func (s *Synchronizer) GetPVCs(ctx context.Context, clientset kubernetes.Interface, clusterContext, storageClassName string) (map[string]v1.PersistentVolumeClaim, error) {
+	s.prepare()
+	selection, err := newPVCSelection(s.Opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.getPVCs(ctx, clientset, clusterContext, storageClassName, selection, nil)
+}
+
+// CreateMissingPVCs creates on target, with the storage class
+// storageClassName, the pvcs of sourcePVCs missing from targetPVCs, and
+// returns their namespace/name.
+func (s *Synchronizer) CreateMissingPVCs(ctx context.Context, target kubernetes.Interface, storageClassName string, sourcePVCs, targetPVCs map[string]v1.PersistentVolumeClaim) ([]string, error) {
+	s.prepare()
+	stripBetaAnnotation, err := s.stripsBetaAnnotation(ctx, target, "the target", s.Opts.BetaAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	return s.createMissingPVCs(ctx, target, nil, storageClassName, stripBetaAnnotation, sourcePVCs, targetPVCs)
+}
+
+// RsyncDir rsyncs the dir dirSource, of a volume of size bytes, to dirTarget
+// with the rsync arguments of Opts.
+func (s *Synchronizer) RsyncDir(ctx context.Context, dirSource, dirTarget string, size int64) error {
+	s.prepare()
+	_, err := s.rsyncDir(ctx, dirSource, dirTarget, s.Opts.RsyncArgs, size)
+	return err
+}
+
+// RsyncDirs rsyncs, as Run does for a target, the volumes of sourcePVCs, on
+// the EFS mounted at sourceMountPath, to the ones of their pvc among
+// targetPVCs, on the EFS mounted at targetMountPath, with the rsync arguments
+// and the parallelism of Opts. It returns the namespace/name of the pvcs left
+// pending, among which the ones that failed.
+func (s *Synchronizer) RsyncDirs(ctx context.Context, sourceClient, targetClient kubernetes.Interface, sourceMountPath, targetMountPath string, sourcePVCs, targetPVCs map[string]v1.PersistentVolumeClaim) ([]string, error) {
+	s.prepare()
+	maxInFlightBytes, err := parseQuantity("maxInFlightBytes", s.Opts.MaxInFlightBytes)
+	if err != nil {
+		return nil, err
+	}
+	s.limiter = newByteLimiter(maxInFlightBytes)
+	sourceFileSystems := &fileSystems{s: s, mountPath: sourceMountPath, volumes: make(map[string]efsVolume)}
+	target := &target{
+		context:     "the target",
+		client:      targetClient,
+		fileSystems: &fileSystems{s: s, mountPath: targetMountPath, volumes: make(map[string]efsVolume)},
+		pvcs:        targetPVCs,
+		created:     make(map[string]bool),
+	}
+	pending, _, err := s.rsyncDirs(ctx, sourceClient, target, sourcePVCs, sourceFileSystems, s.Opts.RsyncArgs)
+	return pending, err
+}
+
+func (s *Synchronizer) run(ctx context.Context) error {
+	if err := checkArgs(s.Opts); err != nil {
+		return err
+	}
+	if s.Opts.DryRunCreateDirs {
+		s.warn("--dryRunCreateDirs is deprecated and ignored, dry-run always creates the mount point directories now")
+	}
+	if s.Opts.SelfTest {
+		return s.selfTest(ctx)
+	}
+	if s.Opts.Estimate {
+		s.Opts.DryRun = true
+	}
+	inCluster, err := s.resolveInCluster(s.Opts)
+	if err != nil {
+		return err
+	}
+	if inCluster == "source" {
+		s.Opts.SourceEKSContext = inClusterContext
+	} else if s.Opts.SourceEKSContext, err = sourceContextFromEnv(s.Opts.SourceEKSContext, s.Opts.Context); err != nil {
+		return err
+	}
+	if inCluster == "target" {
+		s.Opts.TargetEKSContext = []string{inClusterContext}
+	} else if len(s.Opts.TargetEKSContext) == 0 {
+		return configError("parse error", errors.New("the required flag `--targetEKSContext' was not specified"))
+	}
+	if s.Opts.PrintResolvedConfig {
+		return s.printResolvedConfig(s.Opts)
+	}
+	if err := s.checkBinaries(s.Opts); err != nil {
+		return err
+	}
+	if err := s.checkEnv(s.Opts.Env); err != nil {
+		return err
+	}
+	selection, err := newPVCSelection(s.Opts)
+	if err != nil {
+		return err
+	}
+	targetSelection := selection.withoutFields()
+	if s.Opts.Parallelism < 1 {
+		return configError("parse error", fmt.Errorf("--parallelism must be at least 1, got %d", s.Opts.Parallelism))
+	}
+	maxInFlightBytes, err := parseQuantity("maxInFlightBytes", s.Opts.MaxInFlightBytes)
+	if err != nil {
+		return err
+	}
+	s.limiter = newByteLimiter(maxInFlightBytes)
+	if s.autoStrategyThreshold, err = parseQuantity("autoStrategyThreshold", s.Opts.AutoStrategyThreshold); err != nil {
+		return err
+	}
+	if s.Opts.CheckpointLog != "" {
+		if s.checkpoints, err = loadCheckpointLog(s.Opts.CheckpointLog); err != nil {
+			return configError("Couldn't load checkpoint log "+s.Opts.CheckpointLog, err)
+		}
+	}
+	if s.Opts.NameMapFile != "" {
+		if s.nameMapping, err = loadNameMap(s.Opts.NameMapFile); err != nil {
+			return configError("Couldn't load name map "+s.Opts.NameMapFile, err)
+		}
+	}
+
+	health, shutdownHealth, err := s.startHealthServer(s.Opts.HealthAddr)
+	if err != nil {
+		return err
+	}
+	defer shutdownHealth()
+	shutdownTracing, err := s.initTracing(s.Opts.OtlpEndpoint)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing()
+	defer s.unmountAll()
+	if s.Opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Opts.Timeout)
+		defer cancel()
+	}
+	ctx, migrationSpan := startSpan(ctx, "migration")
+	defer migrationSpan.End()
+
+	// get-info
+	s.log("start")
+	if s.Opts.PreRunCommand != "" {
+		if err := s.runHook(ctx, "preRunCommand", s.Opts.PreRunCommand); err != nil {
+			return configError("Aborting the run", err)
+		}
+	}
+	_, span := startSpan(ctx, "discover")
+	s.checkRsyncArgs(ctx, s.Opts.RsyncArgs)
+	if err := checkRsyncArgsKeepSource(s.Opts.RsyncArgs); err != nil {
+		return err
+	}
+	sourceClient := s.Source
+	if sourceClient == nil {
+		var sourceContext string
+		sourceClient, sourceContext, err = s.getK8sClientForContext(s.Opts.SourceEKSContext, s.Opts.SourceAwsProfile, s.Opts.SourceCAFile, inCluster == "source")
+		if err != nil {
+			return err
+		}
+		s.Opts.SourceEKSContext = sourceContext
+	}
+	s.log("SourceEKSContext loaded successfully")
+
+	if s.Opts.SourceEFSDNSName == "" && s.Opts.SourceMountPath == "" && s.Opts.Region == "" {
+		return configError("parse error", errors.New("either --sourceEFSDNSName, --sourceMountPath or --region is required"))
+	}
+	targets, err := buildTargets(s.Opts)
+	if err != nil {
+		return err
+	}
+	if s.Opts.ExportManifests != "" && len(targets) > 1 {
+		return configError("parse error", errors.New("--exportManifests needs a single --targetEKSContext"))
+	}
+	if s.Targets != nil && len(s.Targets) != len(targets) {
+		return configError("", fmt.Errorf("got %d target clients for %d --targetEKSContext", len(s.Targets), len(targets)))
+	}
+	for i, target := range targets {
+		if s.Targets != nil {
+			target.client = s.Targets[i]
+		} else if target.client, target.context, err = s.getK8sClientForContext(target.context, target.awsProfile, target.caFile, inCluster == "target"); err != nil {
+			return err
+		}
+		s.Opts.TargetEKSContext[i] = target.context
+		if err := checkTargetContextAllowed(target.context, s.Opts.AllowedTargetContexts); err != nil {
+			return err
+		}
+		s.log(fmt.Sprintf("TargetEKSContext %s loaded successfully", target.context))
+		if target.stripBetaAnnotation, err = s.stripsBetaAnnotation(ctx, target.client, target.context, s.Opts.BetaAnnotation); err != nil {
+			return err
+		}
+		if s.Opts.EmitEvents {
+			var stopRecorder func()
+			target.recorder, stopRecorder = newEventRecorder(target.client)
+			defer stopRecorder()
+		}
+		if s.Opts.Lock {
+			if s.Opts.DryRun {
+				s.log("not locking " + target.context + " in dry-run")
+			} else {
+				release, err := s.acquireLock(ctx, target.client, target.context, s.Opts.LockNamespace, s.Opts.LockWait)
+				if err != nil {
+					return err
+				}
+				defer release()
+			}
+		}
+	}
+	if err := s.checkDeleteRehearsed(s.Opts); err != nil {
+		return err
+	}
+
+	health.setReady()
+
+	if s.Opts.DiffStorageClasses {
+		sourceParameters, err := s.getStorageClassParameters(ctx, sourceClient, s.Opts.SourceEKSContext, s.Opts.SourceStorageClass)
+		if err != nil {
+			return err
+		}
+		if err := s.printStorageClassDiffs(ctx, s.Opts.SourceEKSContext, s.Opts.SourceStorageClass, sourceParameters, targets); err != nil {
+			return err
+		}
+		s.log("end")
+		return nil
+	}
+
+	fileSystemIdSource := ""
+	if s.needsFileSystemId(s.Opts.SourceMountPath) {
+		storageClassParamsSource, err := s.getStorageClassParameters(ctx, sourceClient, s.Opts.SourceEKSContext, s.Opts.SourceStorageClass)
+		if err != nil {
+			return err
+		}
+		fileSystemIdSource = storageClassParamsSource["fileSystemId"]
+		s.log(fmt.Sprintf("StorageClassSource fileSystemId: %s", fileSystemIdSource))
+	}
+	if s.Opts.SourceEFSDNSName == "" && s.Opts.SourceMountPath == "" {
+		if s.Opts.SourceEFSDNSName, err = s.resolveEFSDNSName(ctx, s.Opts.Region, s.Opts.SourceAwsProfile, fileSystemIdSource); err != nil {
+			return err
+		}
+	}
+	sourceFileSystems, err := s.newFileSystems("source-", s.Opts.SourceEFSDNSName, s.Opts.SourceMountPath, fileSystemIdSource)
+	if err != nil {
+		return err
+	}
+	sourceFileSystems.readOnly = true
+
+	pvcsSource, err := s.getPVCs(ctx, sourceClient, s.Opts.SourceEKSContext, s.Opts.SourceStorageClass, selection, nil)
+	if err != nil {
+		return err
+	}
+	if s.Opts.HelmRelease != "" {
+		if pvcsSource, err = s.withHelmRelease(ctx, sourceClient, pvcsSource, s.Opts.HelmRelease); err != nil {
+			return err
+		}
+	}
+	if s.Opts.MinSize != "" || s.Opts.MaxSize != "" {
+		minSize, err := parseQuantity("minSize", s.Opts.MinSize)
+		if err != nil {
+			return err
+		}
+		maxSize, err := parseQuantity("maxSize", s.Opts.MaxSize)
+		if err != nil {
+			return err
+		}
+		pvcsSource = withinSizeRange(pvcsSource, minSize, maxSize)
+	}
+	s.log(fmt.Sprintf("There are %d pvcs in the source cluster that match selection", len(pvcsSource)))
+	s.report.source(s.Opts.SourceEKSContext, len(pvcsSource))
+	deferred := make([]string, 0)
+	location, err := time.LoadLocation(s.Opts.Timezone)
+	if err != nil {
+		return configError("Invalid --timezone "+s.Opts.Timezone, err)
+	}
+	pvcsSource, outsideWindow, err := limitToWindows(pvcsSource, time.Now().In(location))
+	if err != nil {
+		return err
+	}
+	if len(outsideWindow) > 0 {
+		deferred = append(deferred, outsideWindow...)
+		s.log(fmt.Sprintf("%d pvcs left for a next run, outside of their %s: %s", len(outsideWindow), windowAnnotation, strings.Join(outsideWindow, ", ")))
+	}
+	if s.Opts.MaxVolumesPerNamespace > 0 {
+		var limited []string
+		pvcsSource, limited = limitPerNamespace(pvcsSource, s.Opts.MaxVolumesPerNamespace)
+		deferred = append(deferred, limited...)
+		s.log(fmt.Sprintf("%d pvcs left for a next run by --maxVolumesPerNamespace: %s", len(limited), strings.Join(limited, ", ")))
+	}
+	if s.Opts.StorageClassFromPV {
+		if err := sourceFileSystems.resolveVolumes(ctx, sourceClient, pvcsSource); err != nil {
+			return err
+		}
+	}
+
+	for _, target := range targets {
+		fileSystemIdTarget := ""
+		if s.needsFileSystemId(target.mountPath) {
+			storageClassParamsTarget, err := s.getStorageClassParameters(ctx, target.client, target.context, target.storageClass)
+			if err != nil {
+				return err
+			}
+			fileSystemIdTarget = storageClassParamsTarget["fileSystemId"]
+			s.log(fmt.Sprintf("StorageClassTarget fileSystemId on %s: %s", target.context, fileSystemIdTarget))
+		}
+		if target.efsDNSName == "" && target.mountPath == "" {
+			if target.efsDNSName, err = s.resolveEFSDNSName(ctx, s.Opts.Region, target.awsProfile, fileSystemIdTarget); err != nil {
+				return err
+			}
+		}
+		if target.fileSystems, err = s.newFileSystems("target-", target.efsDNSName, target.mountPath, fileSystemIdTarget); err != nil {
+			return err
+		}
+		target.fileSystems.readOnly = s.Opts.DryRun
+		if !s.Opts.AllowSameFilesystem {
+			if err := checkDifferentFileSystems(sourceFileSystems, target.fileSystems); err != nil {
+				return err
+			}
+		}
+
+		if target.pvcs, err = s.getPVCs(ctx, target.client, target.context, target.storageClass, targetSelection, s.nameMapping); err != nil {
+			return err
+		}
+		s.log(fmt.Sprintf("There are %d pvcs in the target cluster %s that match selection", len(target.pvcs), target.context))
+		s.report.discovered(target.context, len(target.pvcs))
+
+		if err := s.checkTargetStorageClasses(ctx, target.client, target.context, target.storageClass, pvcsSource, s.needsFileSystemId(target.mountPath)); err != nil {
+			return err
+		}
+	}
+
+	span.End()
+
+	if s.Opts.ExportManifests != "" {
+		if err := s.exportManifests(s.Opts.ExportManifests, targets[0].storageClass, targets[0].stripBetaAnnotation, pvcsSource); err != nil {
+			return err
+		}
+		s.log("end")
+		return nil
+	}
+
+	if s.Opts.CheckSecurityGroups {
+		if err := s.checkMountTargetSecurityGroups(ctx, s.Opts.Region, s.Opts.SourceAwsProfile, sourceFileSystems); err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if err := s.checkMountTargetSecurityGroups(ctx, s.Opts.Region, target.awsProfile, target.fileSystems); err != nil {
+				return err
+			}
+		}
+	}
+
+	// mount
+	_, span = startSpan(ctx, "mount")
+	if err := sourceFileSystems.mountAll(ctx); err != nil {
+		return err
+	}
+	if s.Opts.SourceMarkerFile != "" {
+		if err := sourceFileSystems.checkMarker(ctx, s.Opts.SourceMarkerFile); err != nil {
+			return err
+		}
+	}
+	for _, target := range targets {
+		if err := target.fileSystems.mountAll(ctx); err != nil {
+			return err
+		}
+	}
+	span.End()
+
+	if s.Opts.Estimate {
+		if err := s.estimate(ctx, sourceFileSystems, targets, pvcsSource, s.Opts.RsyncArgs); err != nil {
+			return err
+		}
+		s.log("end")
+		return nil
+	}
+
+	pending := deferred
+	var rsyncErr error
+	for _, target := range targets {
+		s.log("synchronizing target " + target.context)
+		targetCtx, targetSpan := startSpan(ctx, "synchronize-target", attribute.String("context", target.context))
+
+		// createMissingPVCs
+		_, span = startSpan(targetCtx, "create-pvcs")
+		if err := s.resolveImmutableConflicts(ctx, target, pvcsSource); err != nil {
+			return err
+		}
+		for attempt := 1; attempt <= s.Opts.BindMaxAttempts; attempt++ {
+			s.log(fmt.Sprintf("creating missing PVCs on target, attempt %d...", attempt))
+			created, err := s.createMissingPVCs(ctx, target.client, target.recorder, target.storageClass, target.stripBetaAnnotation, pvcsSource, target.pvcs)
+			if err != nil {
+				return err
+			}
+			s.log(fmt.Sprintf("%d pvcs created", len(created)))
+			s.report.created(target.context, created)
+			for _, name := range created {
+				target.created[name] = true
+			}
+			if len(created) == 0 {
+				break
+			}
+			s.log("Waiting pvs to be created...")
+			select {
+			case <-time.After(s.Opts.BindWaitInterval):
+			case <-ctx.Done():
+				return clusterError("Stopped waiting for pvs to be created", s.cancelled(ctx, ctx.Err()))
+			}
+			if target.pvcs, err = s.getPVCs(ctx, target.client, target.context, target.storageClass, targetSelection, s.nameMapping); err != nil {
+				return err
+			}
+		}
+		if s.Opts.BindTimeout > 0 && !s.Opts.DryRun {
+			if err := s.waitForBound(ctx, target, targetSelection, pvcsSource); err != nil {
+				return err
+			}
+		}
+		if s.Opts.StorageClassFromPV {
+			if err := target.fileSystems.resolveVolumes(ctx, target.client, target.pvcs); err != nil {
+				return err
+			}
+			if !s.Opts.AllowSameFilesystem {
+				if err := checkDifferentFileSystems(sourceFileSystems, target.fileSystems); err != nil {
+					return err
+				}
+			}
+			if err := target.fileSystems.mountAll(ctx); err != nil {
+				return err
+			}
+		}
+		if s.Opts.StrictVolumeReady {
+			if unbound := s.unboundVolumes(pvcsSource, target.pvcs); len(unbound) > 0 {
+				err := fmt.Errorf("%d volumes not bound on %s: %s", len(unbound), target.context, strings.Join(unbound, ", "))
+				if !s.Opts.DryRun {
+					return clusterError("Volumes not ready", err)
+				}
+				s.warn(err.Error())
+			}
+		}
+		if s.Opts.StrictSize {
+			if smaller := s.smallerTargets(pvcsSource, target.pvcs); len(smaller) > 0 {
+				return clusterError("Target pvcs too small", fmt.Errorf("%d pvcs on %s request less storage than their source: %s", len(smaller), target.context, strings.Join(smaller, "; ")))
+			}
+		}
+		span.End()
+
+		// rsync
+		rsyncCtx, span := startSpan(targetCtx, "rsync")
+		stopDfProgress := func() {}
+		if s.Opts.DfProgress {
+			if stopDfProgress, err = s.dfProgress(ctx, target, sourceFileSystems); err != nil {
+				return err
+			}
+		}
+		targetPending, err := s.rsyncDirsWithRetries(rsyncCtx, sourceClient, target, pvcsSource, sourceFileSystems, s.Opts.RsyncArgs)
+		stopDfProgress()
+		pending = append(pending, targetPending...)
+		span.End()
+		targetSpan.End()
+		if ExitCode(err) == exitRsync && ctx.Err() == nil {
+			s.warn(err.Error())
+			rsyncErr = err
+		} else if err != nil {
+			return err
+		}
+	}
+	s.log("summary: " + s.transferredSummary(s.report.transferred()) + " to all targets")
+	for _, target := range targets {
+		if len(target.unbound) > 0 {
+			s.warn(fmt.Sprintf("summary: %d pvcs never bound on %s within --bindTimeout, not synchronized: %s", len(target.unbound), target.context, strings.Join(target.unbound, ", ")))
+		}
+		if len(target.recreated) > 0 {
+			s.log(fmt.Sprintf("summary: %d pvcs recreated on %s after an immutable conflict: %s", len(target.recreated), target.context, strings.Join(target.recreated, ", ")))
+		}
+		if len(target.conflicts) > 0 {
+			conflicts := make([]string, 0, len(target.conflicts))
+			for sourceIndex := range target.conflicts {
+				conflicts = append(conflicts, s.nameMapping.target(sourceIndex))
+			}
+			sort.Strings(conflicts)
+			s.warn(fmt.Sprintf("summary: %d pvcs on %s differ from their source in an immutable field, not synchronized: %s", len(conflicts), target.context, strings.Join(conflicts, ", ")))
+		}
+	}
+	if len(deferred) > 0 {
+		s.log(fmt.Sprintf("%d pvcs still to synchronize in a next run", len(deferred)))
+	}
+	if s.Opts.PendingManifest != "" {
+		if err := writePendingManifest(s.Opts.PendingManifest, pending); err != nil {
+			return configError("Couldn't write pending manifest "+s.Opts.PendingManifest, err)
+		}
+		s.log(fmt.Sprintf("pending pvcs written to %s", s.Opts.PendingManifest))
+	}
+	if s.Opts.DeleteExtraneous && rsyncErr == nil {
+		if !s.Opts.DryRun {
+			s.forgetDeleteRehearsal(s.Opts)
+		} else if err := markDeleteRehearsed(s.Opts); err != nil {
+			s.warn(fmt.Sprintf("Couldn't record the dry-run of --deleteExtraneous: %s", err))
+		}
+	}
+	if s.Opts.PostRunCommand != "" {
+		if err := s.runHook(ctx, "postRunCommand", s.Opts.PostRunCommand); err != nil {
+			s.warn(err.Error())
+		}
+	}
+	s.log("end")
+	return rsyncErr
+}
+
+// Parse parses the command line into opts. The go-flags error returned when
+// the help was printed can be told apart with flags.WroteHelp.
+func Parse(opts *Opts) ([]string, error) {
+	parser := flags.NewParser(opts, flags.Default)
+	args, err := parser.Parse()
+	if flags.WroteHelp(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, configError("parse error", err)
+	}
+	if len(args) != 0 {
+		return nil, configError("", fmt.Errorf("Too many arguments: %s", args))
+	}
+	if opts.Archive {
+		opts.RsyncArgs = archiveRsyncArgs(opts.RsyncArgs, parser.FindOptionByLongName("rsyncArgs").IsSetDefault())
+	}
+	if err := checkDeleteArgs(opts); err != nil {
+		return nil, err
+	}
+	if err := checkCheckpointArgs(opts); err != nil {
+		return nil, err
+	}
+	if err := checkConflictArgs(opts); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// archiveRsyncArgs replaces the default rsync arguments by rsync's archive
+// mode, keeping the ones given explicitly on top of it.
+func archiveRsyncArgs(rsyncArgs string, isDefault bool) string {
+	if isDefault {
+		return "-a"
+	}
+	return "-a " + rsyncArgs
+}
+
+func parseQuantity(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, configError(fmt.Sprintf("Invalid quantity for %s: %s", name, value), err)
+	}
+	return quantity.Value(), nil
+}
+
+func (s *Synchronizer) printLine(a ...interface{}) {
+	s.logMutex.Lock()
+	defer s.logMutex.Unlock()
+	fmt.Fprintln(s.output, a...)
+}
+
+func (s *Synchronizer) log(message string) {
+	if !s.Opts.Quiet {
+		if s.Opts.DryRun {
+			message = " [DRY RUN] " + message
+		}
+		currentTime := time.Now()
+		s.printLine(currentTime.Format("2006-01-02T15:04:05.00Z07:00") + " - INFO - " + message)
+	}
+}
+
+func (s *Synchronizer) warn(message string) {
+	if s.Opts.DryRun {
+		message = " [DRY RUN] " + message
+	}
+	currentTime := time.Now()
+	s.printLine(currentTime.Format("2006-01-02T15:04:05.00Z07:00") + " - WARN - " + message)
+}
+
+func (s *Synchronizer) getStorageClassParameters(ctx context.Context, clientset kubernetes.Interface, clusterContext, storageClassName string) (map[string]string, error) {
+	ret, err := s.getStorageClass(ctx, clientset, storageClassName)
+	if err != nil {
+		return nil, clusterError(fmt.Sprintf("Couldn't get storage class named %s on %s", storageClassName, clusterContext), s.cancelled(ctx, err))
+	}
+	return ret.Parameters, nil
+}
+
+func (s *Synchronizer) getStorageClass(ctx context.Context, clientset kubernetes.Interface, storageClassName string) (*storagev1.StorageClass, error) {
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	return clientset.StorageV1().StorageClasses().Get(apiCtx, storageClassName, metav1.GetOptions{})
+}
+
+// needsFileSystemId tells whether the fileSystemId of the storage class is
+// needed, that is whether the EFS has to be mounted by the synchronizer. If
+// it is already mounted at mountPath the storage class doesn't have to be read.
+func (s *Synchronizer) needsFileSystemId(mountPath string) bool {
+	return mountPath == "" || s.Opts.StorageClassFromPV
+}
+
+// checkTargetStorageClasses returns an error early if a storage class that
+// missing PVCs would be created with doesn't exist on the target or isn't
+// backed by EFS. Unless required, storage classes that can't be read are only
+// warned about.
+func (s *Synchronizer) checkTargetStorageClasses(ctx context.Context, targetClientset kubernetes.Interface, targetContext, targetStorageClass string, sourcePVCs map[string]v1.PersistentVolumeClaim, required bool) error {
+	checked := make(map[string]bool)
+	for _, sourcePVC := range sourcePVCs {
+		storageClassName := targetStorageClass
+		if storageClassName == "" {
+			storageClassName = storageClassOf(sourcePVC)
+		}
+		if storageClassName == "" || checked[storageClassName] {
+			continue
+		}
+		checked[storageClassName] = true
+
+		storageClass, err := s.getStorageClass(ctx, targetClientset, storageClassName)
+		if err != nil && !required && apierrors.IsForbidden(err) {
+			s.warn(fmt.Sprintf("Couldn't check storage class %s on %s: %s", storageClassName, targetContext, err))
+			continue
+		}
+		if err != nil {
+			return clusterError(fmt.Sprintf("Couldn't get storage class named %s on %s", storageClassName, targetContext), s.cancelled(ctx, err))
+		}
+		if storageClass.Provisioner != efsProvisioner {
+			return configError(fmt.Sprintf("Storage class %s on %s isn't an EFS storage class", storageClassName, targetContext),
+				fmt.Errorf("provisioner is %s, expected %s", storageClass.Provisioner, efsProvisioner))
+		}
+		s.log(fmt.Sprintf("Storage class %s exists on %s", storageClassName, targetContext))
+	}
+	return nil
+}
+
+// storageClassOf returns the storage class of the pvc, from its spec or from
+// the legacy beta annotation.
+func storageClassOf(pvc v1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+		return *pvc.Spec.StorageClassName
+	}
+	return pvc.ObjectMeta.Annotations[betaStorageClassAnnotation]
+}
+
+// pvcPageSize is the number of pvcs listed per request, so that large
+// clusters aren't loaded in memory, nor sent by the API server, at once.
+const pvcPageSize = 500
+
+// getPVCs returns the pvcs of the storage class selected by the regexes,
+// along with the ones that are destinations of mapped, when listing the
+// target of renamed pvcs.
+func (s *Synchronizer) getPVCs(ctx context.Context, clientset kubernetes.Interface, clusterContext, storageClassName string, selection *pvcSelection, mapped nameMap) (map[string]v1.PersistentVolumeClaim, error) {
+	pvcs := make(map[string]v1.PersistentVolumeClaim, 0)
+	listOptions := metav1.ListOptions{Limit: pvcPageSize, LabelSelector: selection.labelSelector, FieldSelector: selection.fieldSelector}
+	for {
+		apiCtx, cancel := s.apiContext(ctx)
+		result, err := clientset.CoreV1().PersistentVolumeClaims("").List(apiCtx, listOptions)
+		cancel()
+		if err != nil {
+			return nil, clusterError("Couldn't list pvcs on "+clusterContext, s.cancelled(ctx, err))
+		}
+
+		for _, value := range result.Items {
+			key := value.ObjectMeta.Namespace + "/" + value.ObjectMeta.Name
+			if (selection.matches(value.ObjectMeta.Namespace, value.ObjectMeta.Name) && selection.matchesFields(value)) || mapped.isTarget(key) {
+				if annotation, _ := value.ObjectMeta.Annotations[betaStorageClassAnnotation]; (value.Spec.StorageClassName != nil && *value.Spec.StorageClassName == storageClassName) || annotation == storageClassName {
+					pvcs[key] = value
+				}
+			}
+		}
+		if result.Continue == "" {
+			return pvcs, nil
+		}
+		listOptions.Continue = result.Continue
+	}
+}
+
+func (s *Synchronizer) createMissingPVCs(ctx context.Context, targetClientset kubernetes.Interface, recorder record.EventRecorder, targetStorageclass string, stripBetaAnnotation bool, sourcePVCs, targetPVCs map[string]v1.PersistentVolumeClaim) ([]string, error) {
+	createdPVCs := make([]string, 0)
+	forbiddenNamespaces := make(map[string]bool)
+	for sourceIndex, sourcePVC := range sourcePVCs {
+		targetIndex := s.nameMapping.target(sourceIndex)
+		if _, ok := targetPVCs[targetIndex]; !ok {
+			namespace, _, _ := strings.Cut(targetIndex, "/")
+			if forbiddenNamespaces[namespace] {
+				s.log("skipping pvc, creating pvcs is forbidden in namespace " + namespace + ": " + sourceIndex)
+				continue
+			}
+			newName, err := s.createVPC(ctx, targetClientset, recorder, targetStorageclass, stripBetaAnnotation, sourceIndex, sourcePVC)
+			if apierrors.IsForbidden(err) && s.Opts.SkipForbiddenNamespaces {
+				s.warn(fmt.Sprintf("Skipping namespace %s: %s", namespace, err))
+				forbiddenNamespaces[namespace] = true
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			createdPVCs = append(createdPVCs, newName)
+			s.log("created pvc " + newName)
+		}
+	}
+
+	if s.Opts.DryRun {
+		return []string{}, nil
+	} else {
+		return createdPVCs, nil
+	}
+}
+
+// forbiddenGuidance explains, for namespace, why creating a pvc there was
+// forbidden and what to do about it.
+func forbiddenGuidance(namespace string, err error) string {
+	if containsAny(err, "exceeded quota") {
+		return fmt.Sprintf("namespace %s on target is out of its ResourceQuota: raise its requests.storage or persistentvolumeclaims quota, or free some", namespace)
+	}
+	return fmt.Sprintf("the target context can't create pvcs in namespace %s: grant it create on persistentvolumeclaims there", namespace)
+}
+
+// createVPC creates the target pvc of the source pvc name and returns its
+// key. Forbidden errors, which the caller may skip, explain what to do about
+// them.
+func (s *Synchronizer) createVPC(ctx context.Context, clientSet kubernetes.Interface, recorder record.EventRecorder, newStorageClass string, stripBetaAnnotation bool, name string, pvc v1.PersistentVolumeClaim) (newName string, err error) {
+	s.log("creating pvc " + name)
+	createOptions := metav1.CreateOptions{}
+	if s.Opts.DryRun {
+		createOptions.DryRun = []string{"All"}
+	}
+	pvcNew, err := s.newTargetPVC(newStorageClass, stripBetaAnnotation, name, pvc)
+	if err != nil {
+		return "", err
+	}
+
+	// GitOps controllers may be changing the namespace at the same time, so
+	// conflicts are retried with backoff
+	var ret *v1.PersistentVolumeClaim
+	backoff := retry.DefaultBackoff
+	backoff.Steps = s.Opts.RequeueOnConflict + 1
+	err = retry.OnError(backoff, apierrors.IsConflict, func() (err error) {
+		apiCtx, cancel := s.apiContext(ctx)
+		defer cancel()
+		ret, err = clientSet.CoreV1().PersistentVolumeClaims(pvcNew.ObjectMeta.Namespace).Create(apiCtx, pvcNew, createOptions)
+		if apierrors.IsConflict(err) {
+			s.log(fmt.Sprintf("conflict creating pvc %s: %s", name, err))
+		}
+		return err
+	})
+	if apierrors.IsForbidden(err) {
+		err = fmt.Errorf("%w\n%s", err, forbiddenGuidance(pvcNew.ObjectMeta.Namespace, err))
+	}
+	if err != nil {
+		return "", clusterError(fmt.Sprintf("Couldn't create pvc on target %s", name), s.cancelled(ctx, err))
+	}
+
+	s.emitEvent(recorder, ret, v1.EventTypeNormal, "VolumeSyncCreated", fmt.Sprintf("Created from pvc %s of %s", name, s.Opts.SourceEKSContext))
+
+	requested := pvcNew.Spec.Resources.Requests[v1.ResourceStorage]
+	created := ret.Spec.Resources.Requests[v1.ResourceStorage]
+	if requested.Cmp(created) != 0 {
+		s.warn(fmt.Sprintf("pvc %s was created with a storage request of %s instead of %s", name, created.String(), requested.String()))
+	}
+
+	return ret.ObjectMeta.Namespace + "/" + ret.ObjectMeta.Name, nil
+}
+
+// newTargetPVC returns the pvc to create on the target for the source pvc
+// name: renamed by --nameMapFile, with newStorageClass, the size of its
+// target-size annotation and without what binds it to its source volume.
+func (s *Synchronizer) newTargetPVC(newStorageClass string, stripBetaAnnotation bool, name string, pvc v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, error) {
+	pvcNew := pvc.DeepCopy()
+	if targetName := s.nameMapping.target(name); targetName != name {
+		pvcNew.ObjectMeta.Namespace, pvcNew.ObjectMeta.Name, _ = strings.Cut(targetName, "/")
+		s.log(fmt.Sprintf("pvc %s is created as %s as set by --nameMapFile", name, targetName))
+	}
+
+	// update some metadata entries
+	pvcNew.SetCreationTimestamp(metav1.Now())
+	pvcNew.SetUID("")
+	delete(pvcNew.ObjectMeta.Annotations, "pv.kubernetes.io/bind-completed")
+	delete(pvcNew.ObjectMeta.Annotations, "pv.kubernetes.io/bound-by-controller")
+	pvcNew.Spec.VolumeName = ""
+	pvcNew.ObjectMeta.ResourceVersion = ""
+	if newStorageClass != "" {
+		if pvcNew.Spec.StorageClassName != nil && *pvcNew.Spec.StorageClassName != "" {
+			*pvcNew.Spec.StorageClassName = newStorageClass
+		}
+		if _, ok := pvcNew.ObjectMeta.Annotations[betaStorageClassAnnotation]; ok {
+			pvcNew.ObjectMeta.Annotations[betaStorageClassAnnotation] = newStorageClass
+		}
+	}
+	if stripBetaAnnotation {
+		withoutBetaAnnotation(pvcNew)
+	}
+
+	if targetSize, ok := pvc.ObjectMeta.Annotations[targetSizeAnnotation]; ok {
+		size, err := resource.ParseQuantity(targetSize)
+		if err != nil {
+			return nil, configError(fmt.Sprintf("Invalid %s annotation on pvc %s", targetSizeAnnotation, name), err)
+		}
+		sourceSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		if size.Cmp(sourceSize) < 0 {
+			return nil, configError(fmt.Sprintf("Invalid %s annotation on pvc %s", targetSizeAnnotation, name),
+				fmt.Errorf("%s is smaller than the source request %s", size.String(), sourceSize.String()))
+		}
+		if pvcNew.Spec.Resources.Requests == nil {
+			pvcNew.Spec.Resources.Requests = v1.ResourceList{}
+		}
+		pvcNew.Spec.Resources.Requests[v1.ResourceStorage] = size
+		s.log(fmt.Sprintf("requesting %s for pvc %s as set by its %s annotation", size.String(), name, targetSizeAnnotation))
+	}
+	return pvcNew, nil
+}
+
+func (s *Synchronizer) mountEFS(ctx context.Context, prefix, fileSystemId string, EFSDNSName, mountArgs string) (mountPath string, err error) {
+	mountPath = fmt.Sprintf("/tmp/%s%s", prefix, fileSystemId)
+	EFSDNSName = EFSDNSName + ":/"
+
+	s.log("creating dir...")
+	if err := os.MkdirAll(mountPath, 0o755); err != nil {
+		return "", mountError("Couldn't create dir "+mountPath, err)
+	}
+
+	s.log("mounting NFS...")
+	args := splitArgs(mountArgs)
+	args = append(args, EFSDNSName)
+	args = append(args, mountPath)
+	output, err := s.runCommand(ctx, nil, s.Opts.MountBinary, args...)
+	if err != nil {
+		return "", mountError("Couldn't mount "+EFSDNSName, s.cancelled(ctx, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))))
+	}
+	return mountPath, nil
+}
+
+// rsyncDirsWithRetries rsyncs the volumes then, up to --phaseRetries times
+// and with a backoff doubling from --phaseRetryBackoff, rsyncs again the ones
+// that failed, so that issues affecting the whole cluster for a while don't
+// need another run.
+func (s *Synchronizer) rsyncDirsWithRetries(ctx context.Context, sourceClient kubernetes.Interface, target *target, pvcsSource map[string]v1.PersistentVolumeClaim, sourceFileSystems *fileSystems, rsyncArgs string) ([]string, error) {
+	pending, failed, err := s.rsyncDirs(ctx, sourceClient, target, pvcsSource, sourceFileSystems, rsyncArgs)
+	backoff := s.Opts.PhaseRetryBackoff
+	for attempt := 1; attempt <= s.Opts.PhaseRetries && len(failed) > 0 && ExitCode(err) == exitRsync; attempt++ {
+		s.warn(fmt.Sprintf("%d volumes failed, rsyncing them again in %s (phase retry %d/%d)", len(failed), backoff, attempt, s.Opts.PhaseRetries))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return pending, rsyncError("Stopped retrying the failed volumes", s.cancelled(ctx, ctx.Err()))
+		}
+		backoff *= 2
+
+		retried := make(map[string]bool, len(failed))
+		subset := make(map[string]v1.PersistentVolumeClaim, len(failed))
+		for _, sourceIndex := range failed {
+			retried[sourceIndex] = true
+			subset[sourceIndex] = pvcsSource[sourceIndex]
+		}
+		stillPending := make([]string, 0, len(pending))
+		for _, sourceIndex := range pending {
+			if !retried[sourceIndex] {
+				stillPending = append(stillPending, sourceIndex)
+			}
+		}
+		var retryPending []string
+		retryPending, failed, err = s.rsyncDirs(ctx, sourceClient, target, subset, sourceFileSystems, rsyncArgs)
+		pending = append(stillPending, retryPending...)
+	}
+	return pending, err
+}
+
+// rsyncDirs rsyncs the volumes of pvcsSource to target and returns the pvcs
+// left pending, among which the ones that failed.
+func (s *Synchronizer) rsyncDirs(ctx context.Context, sourceClient kubernetes.Interface, target *target, pvcsSource map[string]v1.PersistentVolumeClaim, sourceFileSystems *fileSystems, rsyncArgs string) ([]string, []string, error) {
+	s.log("rsyncing dirs...")
+	pending := make([]string, 0)
+	failed := make([]string, 0)
+	results := make([]volumeResult, 0, len(pvcsSource))
+	workers := newRampUp(s.Opts.Parallelism, s.Opts.RampUpDuration)
+	var pendingMutex sync.Mutex
+	var stopErr error
+	for _, sourceIndex := range fairOrder(pvcsSource) {
+		if ctx.Err() != nil {
+			stopErr = rsyncError("Stopped rsyncing to "+target.context, s.cancelled(ctx, ctx.Err()))
+			break
+		}
+		sourcePVC := pvcsSource[sourceIndex]
+		targetPVC, ok := target.pvcs[s.nameMapping.target(sourceIndex)]
+		if !ok {
+			s.log("Couldn't find corresponding pvc on target: " + s.nameMapping.target(sourceIndex))
+			s.report.skip(target.context, sourceIndex, "no pvc on target")
+			pending = append(pending, sourceIndex)
+			continue
+		}
+		if reason, ok := target.conflicts[sourceIndex]; ok {
+			s.log("skipping pvc, " + reason + ": " + sourceIndex)
+			s.report.skip(target.context, sourceIndex, reason)
+			continue
+		}
+		if isBlockVolume(sourcePVC) || isBlockVolume(targetPVC) {
+			s.log("skipping pvc, block volumes can't be rsynced file by file: " + sourceIndex)
+			s.report.skip(target.context, sourceIndex, "block volume")
+			continue
+		}
+		if volumeSize(targetPVC) < volumeSize(sourcePVC) {
+			s.warn("Skipping pvc, " + s.sizeMismatch(sourceIndex, sourcePVC, targetPVC))
+			s.report.skip(target.context, sourceIndex, s.sizeMismatch(sourceIndex, sourcePVC, targetPVC))
+			pending = append(pending, sourceIndex)
+			continue
+		}
+		volumeSource := sourcePVC.Spec.VolumeName
+		volumeTarget := targetPVC.Spec.VolumeName
+		if volumeSource == "" || volumeTarget == "" {
+			s.log("skipping pvc, volume not yet ready: " + sourceIndex)
+			s.report.skip(target.context, sourceIndex, "volume not bound")
+			pending = append(pending, sourceIndex)
+			continue
+		}
+		if err := s.checkVolumeExists(ctx, target.client, volumeTarget); err != nil {
+			s.log("skipping pvc, its target " + err.Error() + ": " + sourceIndex)
+			s.report.skip(target.context, sourceIndex, "target "+err.Error())
+			pending = append(pending, sourceIndex)
+			continue
+		}
+		dirSource, err := sourceFileSystems.dir(ctx, volumeSource)
+		if err != nil {
+			stopErr = err
+			break
+		}
+		dirTarget, err := target.fileSystems.dir(ctx, volumeTarget)
+		if err != nil {
+			stopErr = err
+			break
+		}
+		dirSource += string(os.PathSeparator)
+		dirTarget += string(os.PathSeparator)
+		if s.Opts.SkipIfTargetNotEmpty {
+			empty, err := isEmptyDir(dirTarget)
+			if err != nil {
+				s.log("skipping pvc, couldn't read target dir " + dirTarget + ": " + err.Error())
+				s.report.skip(target.context, sourceIndex, "couldn't read target dir: "+err.Error())
+				continue
+			}
+			if !empty {
+				s.log("skipping pvc, target dir already has data: " + sourceIndex)
+				s.report.skip(target.context, sourceIndex, "target dir not empty")
+				continue
+			}
+		}
+		if err := workers.acquire(ctx); err != nil {
+			stopErr = rsyncError("Stopped rsyncing to "+target.context, s.cancelled(ctx, err))
+			break
+		}
+		weight, err := s.limiter.acquire(ctx, s.sizeEstimate(sourcePVC))
+		if err != nil {
+			workers.release()
+			stopErr = rsyncError("Stopped rsyncing to "+target.context, s.cancelled(ctx, err))
+			break
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer workers.release()
+			defer s.limiter.release(weight)
+			_, span := startSpan(ctx, "rsync-volume", attribute.String("pvc", sourceIndex), attribute.String("source", dirSource), attribute.String("target", dirTarget))
+			start := time.Now()
+			stats, err := s.rsyncDir(ctx, dirSource, dirTarget, rsyncArgs, volumeSize(sourcePVC))
+			result := volumeResult{pvc: sourceIndex, size: volumeSize(sourcePVC), err: err, duration: time.Since(start), stats: stats, created: target.created[s.nameMapping.target(sourceIndex)]}
+			span.SetAttributes(attribute.Int64("transferred_bytes", stats.transferredBytes), attribute.Float64("throughput_mbps", result.throughput()))
+			endSpan(span, err)
+			pendingMutex.Lock()
+			results = append(results, result)
+			s.report.volume(target.context, result)
+			if s.Opts.ReportEvery > 0 && len(results)%s.Opts.ReportEvery == 0 {
+				s.log(progressReport(results, len(pvcsSource)))
+			}
+			pendingMutex.Unlock()
+			if err != nil {
+				s.emitEvent(target.recorder, &targetPVC, v1.EventTypeWarning, "VolumeSyncFailed", fmt.Sprintf("Couldn't synchronize from pvc %s of %s: %s", sourceIndex, s.Opts.SourceEKSContext, err))
+				pendingMutex.Lock()
+				pending = append(pending, sourceIndex)
+				failed = append(failed, sourceIndex)
+				pendingMutex.Unlock()
+			} else if s.Opts.AnnotateSource {
+				s.annotateMigrated(ctx, sourceClient, sourceIndex, sourcePVC, target.context)
+			}
+		}()
+	}
+	s.log("waiting rsync jobs...")
+	s.wg.Wait()
+	s.logSummary(target.context, results)
+	if stopErr != nil {
+		return pending, failed, stopErr
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return pending, failed, rsyncError(fmt.Sprintf("Couldn't rsync %d volumes to %s", len(failed), target.context), errors.New(strings.Join(failed, ", ")))
+	}
+	return pending, failed, nil
+}
+
+// checkVolumeExists returns an error when the pv volumeName, that a pvc is
+// bound to, was deleted, so that nothing is rsynced to a path that doesn't
+// hold it. A pv that can't be read is assumed to exist.
+func (s *Synchronizer) checkVolumeExists(ctx context.Context, clientset kubernetes.Interface, volumeName string) error {
+	apiCtx, cancel := s.apiContext(ctx)
+	defer cancel()
+	_, err := clientset.CoreV1().PersistentVolumes().Get(apiCtx, volumeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("pvc is bound to pv %s which doesn't exist anymore, delete the pvc to have it created again", volumeName)
+	}
+	if err != nil {
+		s.warn(fmt.Sprintf("Couldn't check pv %s exists: %s", volumeName, s.cancelled(ctx, err)))
+	}
+	return nil
+}
+
+// unboundVolumes returns the sorted keys of the source pvcs whose source or
+// target pvc is missing or not bound to a volume yet.
+func (s *Synchronizer) unboundVolumes(pvcsSource, pvcsTarget map[string]v1.PersistentVolumeClaim) []string {
+	unbound := make([]string, 0)
+	for sourceIndex, sourcePVC := range pvcsSource {
+		targetPVC, ok := pvcsTarget[s.nameMapping.target(sourceIndex)]
+		if !ok || sourcePVC.Spec.VolumeName == "" || targetPVC.Spec.VolumeName == "" {
+			unbound = append(unbound, sourceIndex)
+		}
+	}
+	sort.Strings(unbound)
+	return unbound
+}
+
+func (s *Synchronizer) rsyncDir(ctx context.Context, dirSource, dirTarget, rsyncArgs string, size int64) (rsyncStats, error) {
+	s.log("rsyncing dir " + dirSource + "...")
+	args := splitArgs(rsyncArgs)
+	snapshotRoot := dirTarget
+	if s.Opts.Snapshots {
+		if previous := previousSnapshot(snapshotRoot); previous != "" {
+			args = append(args, "--link-dest="+previous)
+		}
+		dirTarget = filepath.Join(snapshotRoot, s.snapshotName()) + string(os.PathSeparator)
+	}
+	if s.useWholeFile(size) {
+		args = append(args, "-W")
+	}
+	if s.Opts.Devices {
+		args = append(args, "--devices")
+	}
+	if s.Opts.Specials {
+		args = append(args, "--specials")
+	}
+	if s.Opts.SampleFiles > 0 || s.Opts.ExcludeNewerThanStart {
+		var cutoff time.Time
+		if s.Opts.ExcludeNewerThanStart {
+			cutoff = s.startTime
+		}
+		filesFrom, excluded, err := writeFileList(dirSource, s.Opts.SampleFiles, cutoff)
+		if err != nil {
+			s.log("Couldn't write the file list of " + dirSource)
+			s.printLine(withHint(err))
+			return rsyncStats{}, err
+		}
+		defer os.Remove(filesFrom)
+		if excluded > 0 {
+			s.log(fmt.Sprintf("excluding %d files of %s modified after the start of the run", excluded, dirSource))
+		}
+		args = append(args, "--files-from="+filesFrom)
+	}
+	if s.Opts.DeleteExtraneous {
+		args = append(args, "--delete")
+	}
+	if s.Opts.DeleteAfter {
+		args = append(args, "--delete-after")
+	}
+	if s.Opts.DryRun {
+		args = append(args, "--dry-run", "--itemize-changes")
+	}
+	var stats rsyncStats
+	var err error
+	if s.checkpoints != nil || s.Opts.IntraVolumeParallelism > 1 {
+		stats, err = s.rsyncByChild(ctx, args, dirSource, dirTarget)
+	} else {
+		stats, err = s.runRsync(ctx, args, dirSource, dirTarget)
+	}
+	if err != nil || s.Opts.DryRun {
+		return stats, err
+	}
+	s.log(fmt.Sprintf("Successfully rsync %s, %s transferred in %d files", dirSource, bytesQuantity(uint64(stats.transferredBytes)), stats.files))
+	if s.Opts.VerifyCounts && s.Opts.SampleFiles == 0 {
+		err = s.verifyCounts(dirSource, dirTarget, s.Opts.VerifyCountsTolerance)
+		if err != nil {
+			s.warn("Counts differ after rsync: " + err.Error())
+			return stats, err
+		}
+	}
+	if s.Opts.Snapshots {
+		err = markLatestSnapshot(snapshotRoot, s.snapshotName())
+		if err != nil {
+			s.log("Couldn't mark the snapshot of " + dirTarget + " as latest")
+			s.printLine(withHint(err))
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// runRsync runs rsync --stats with args from the source path from to the
+// target path to, streaming its output, and returns its stats or logs why it
+// failed.
+func (s *Synchronizer) runRsync(ctx context.Context, args []string, from, to string) (rsyncStats, error) {
+	args, filterFile, err := s.withFilterFile(args)
+	if err != nil {
+		s.log("Couldn't write the filter file of " + from)
+		s.printLine(withHint(err))
+		return rsyncStats{}, err
+	}
+	if filterFile != "" {
+		defer os.Remove(filterFile)
+	}
+	args = append(args, "--stats", from)
+	args = append(args, to)
+	tail := s.newOutputTail("rsync "+from+": ", !s.Opts.Quiet || s.Opts.DryRun, rsyncOutputTailLines)
+	output, err := s.runCommand(ctx, tail, s.Opts.RsyncBinary, args...)
+	if err != nil && isReadOnlySourceWarning(err, string(output), from) {
+		s.warn("rsync couldn't update the read-only source " + from + ", ignoring: " + rsyncErrors(string(output)))
+		err = nil
+	}
+	if err != nil && tail.String() != "" {
+		err = fmt.Errorf("%w, last lines of rsync's output:\n%s", err, tail.String())
+	}
+	if err != nil {
+		err = s.cancelled(ctx, err)
+	}
+	if err != nil {
+		s.log("Couldn't rsync " + from)
+		s.printLine(withHint(err))
+		return tail.rsyncStats(), err
+	}
+	if s.Opts.DryRun {
+		s.log("Planned transfers of " + from + " listed above")
+		if deleted := tail.deleted(); len(deleted) > 0 {
+			s.warn(fmt.Sprintf("%d files would be deleted from %s: %s", len(deleted), to, strings.Join(deleted, ", ")))
+		}
+	}
+	return tail.rsyncStats(), nil
+}
+
+// useWholeFile tells whether a volume of size bytes is copied with whole
+// files rather than rsync's delta algorithm, which only pays off for big volumes.
+func (s *Synchronizer) useWholeFile(size int64) bool {
+	return s.Opts.WholeFile || (s.Opts.AutoStrategy && size < s.autoStrategyThreshold)
+}
+
+func isBlockVolume(pvc v1.PersistentVolumeClaim) bool {
+	return pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock
+}
+
+// isEmptyDir reports whether dir has no entries. A missing dir, as for a
+// volume nothing was written to yet, is considered empty.
+func isEmptyDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+func (s *Synchronizer) annotateMigrated(ctx context.Context, clientSet kubernetes.Interface, name string, pvc v1.PersistentVolumeClaim, targetContext string) {
+	s.log("annotating source pvc " + name)
+	patchOptions := metav1.PatchOptions{}
+	if s.Opts.DryRun {
+		patchOptions.DryRun = []string{"All"}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				"volume-sync/migrated-to": targetContext,
+				"volume-sync/migrated-at": time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err == nil {
+		apiCtx, cancel := s.apiContext(ctx)
+		defer cancel()
+		_, err = clientSet.CoreV1().PersistentVolumeClaims(pvc.ObjectMeta.Namespace).Patch(apiCtx, pvc.ObjectMeta.Name, types.MergePatchType, patch, patchOptions)
+	}
+	if err != nil {
+		s.log("Couldn't annotate source pvc " + name)
+		s.printLine(s.cancelled(ctx, err))
+	}
+}
@@ -0,0 +1,1032 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flags "github.com/jessevdk/go-flags"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testSynchronizer returns a Synchronizer of the options o, logging to
+// os.Stdout.
+func testSynchronizer(t *testing.T, o Opts) *Synchronizer {
+	t.Helper()
+	s := &Synchronizer{Opts: &o}
+	s.prepare()
+	return s
+}
+
+// fakeCommand puts a command named name first in the PATH until the end of
+// the test, which records its arguments, one call per line, in the returned
+// file and exits with the status.
+func fakeCommand(t *testing.T, name string, status int) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, name+".calls")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\nexit %d\n", calls, status)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// fakeCalls returns the calls recorded by a fakeCommand.
+func fakeCalls(t *testing.T, calls string) []string {
+	t.Helper()
+	data, err := os.ReadFile(calls)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// testPVC returns a Bound pvc requesting 1Gi, changed by the options.
+func testPVC(namespace, name string, options ...func(*v1.PersistentVolumeClaim)) *v1.PersistentVolumeClaim {
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Annotations: map[string]string{}},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+			Resources:   v1.VolumeResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}},
+			VolumeName:  "pv-" + name,
+		},
+		Status: v1.PersistentVolumeClaimStatus{Phase: v1.ClaimBound},
+	}
+	for _, option := range options {
+		option(pvc)
+	}
+	return pvc
+}
+
+func withStorageClass(storageClass string) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) { pvc.Spec.StorageClassName = &storageClass }
+}
+
+func withBetaStorageClass(storageClass string) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) {
+		pvc.Annotations["volume.beta.kubernetes.io/storage-class"] = storageClass
+	}
+}
+
+func withVolumeName(volumeName string) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) { pvc.Spec.VolumeName = volumeName }
+}
+
+func withSize(size string) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) {
+		pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(size)
+	}
+}
+
+func withPhase(phase v1.PersistentVolumeClaimPhase) func(*v1.PersistentVolumeClaim) {
+	return func(pvc *v1.PersistentVolumeClaim) {
+		pvc.Status.Phase = phase
+		pvc.Spec.VolumeName = ""
+	}
+}
+
+// captureOutput returns what s logged while running f.
+func captureOutput(t *testing.T, s *Synchronizer, f func()) string {
+	t.Helper()
+	var logs bytes.Buffer
+	saved := s.output
+	s.output = &logs
+	defer func() { s.output = saved }()
+	f()
+	return logs.String()
+}
+
+// keys returns the sorted keys of pvcs.
+func keys(pvcs map[string]v1.PersistentVolumeClaim) []string {
+	keys := make([]string, 0, len(pvcs))
+	for key := range pvcs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestGetPVCs(t *testing.T) {
+	objects := []runtime.Object{
+		testPVC("default", "by-spec", withStorageClass("efs-sc")),
+		testPVC("default", "by-annotation", withBetaStorageClass("efs-sc")),
+		testPVC("default", "no-storage-class"),
+		testPVC("default", "other-storage-class", withStorageClass("gp3")),
+		testPVC("apps", "in-apps", withStorageClass("efs-sc")),
+		testPVC("apps-staging", "in-apps-staging", withStorageClass("efs-sc")),
+		testPVC("default", "pending", withStorageClass("efs-sc"), withPhase(v1.ClaimPending)),
+	}
+	tests := []struct {
+		name string
+		opts Opts
+		want []string
+	}{
+		{
+			name: "storage class from spec or annotation",
+			opts: Opts{PvcIncludeNamespaceRegex: "^default$", PvcIncludeNameRegex: ".*"},
+			want: []string{"default/by-annotation", "default/by-spec", "default/pending"},
+		},
+		{
+			name: "namespace regex",
+			opts: Opts{PvcIncludeNamespaceRegex: "^apps", PvcIncludeNameRegex: ".*"},
+			want: []string{"apps-staging/in-apps-staging", "apps/in-apps"},
+		},
+		{
+			name: "excluded namespace",
+			opts: Opts{PvcIncludeNamespaceRegex: "^apps", PvcIncludeNameRegex: ".*", PvcExcludeNamespaceRegex: "-staging$"},
+			want: []string{"apps/in-apps"},
+		},
+		{
+			name: "name regex",
+			opts: Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: "^by-"},
+			want: []string{"default/by-annotation", "default/by-spec"},
+		},
+		{
+			name: "unbound pvcs skipped by field selector",
+			opts: Opts{PvcIncludeNamespaceRegex: "^default$", PvcIncludeNameRegex: ".*", PvcFieldSelector: "status.phase=Bound"},
+			want: []string{"default/by-annotation", "default/by-spec"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, test.opts)
+			selection, err := newPVCSelection(&test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pvcs, err := s.getPVCs(context.Background(), fake.NewSimpleClientset(objects...), "source", "efs-sc", selection.withoutFields(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, pvc := range pvcs {
+				if !selection.matchesFields(pvc) {
+					delete(pvcs, key)
+				}
+			}
+			if got := keys(pvcs); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetPVCsFieldSelector(t *testing.T) {
+	opts := Opts{PvcIncludeNamespaceRegex: ".*", PvcIncludeNameRegex: ".*", PvcFieldSelector: "status.phase!=Pending"}
+	s := testSynchronizer(t, opts)
+	selection, err := newPVCSelection(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(
+		testPVC("default", "bound", withStorageClass("efs-sc")),
+		testPVC("default", "pending", withStorageClass("efs-sc"), withPhase(v1.ClaimPending)),
+	)
+
+	pvcs, err := s.getPVCs(context.Background(), client, "source", "efs-sc", selection, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(pvcs), []string{"default/bound"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNewTargetPVCWithoutStorageClassName(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	source := testPVC("default", "data", withBetaStorageClass("efs-sc"))
+	source.Annotations["pv.kubernetes.io/bind-completed"] = "yes"
+
+	target, err := s.newTargetPVC("efs-target", false, "default/data", *source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Spec.StorageClassName != nil {
+		t.Errorf("got spec.storageClassName %q, want none", *target.Spec.StorageClassName)
+	}
+	if got := target.Annotations[betaStorageClassAnnotation]; got != "efs-target" {
+		t.Errorf("got annotation %q, want efs-target", got)
+	}
+	if target.Spec.VolumeName != "" || target.Annotations["pv.kubernetes.io/bind-completed"] != "" {
+		t.Errorf("binding of the source kept: %+v", target)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	if got, err := parseQuantity("maxInFlightBytes", "1Gi"); err != nil || got != 1<<30 {
+		t.Errorf("got %d, %v, want %d", got, err, 1<<30)
+	}
+	if got, err := parseQuantity("maxInFlightBytes", ""); err != nil || got != 0 {
+		t.Errorf("got %d, %v for an empty value, want 0", got, err)
+	}
+	if _, err := parseQuantity("maxInFlightBytes", "lots"); ExitCode(err) != exitConfig {
+		t.Errorf("got %v for an invalid value, want a config error", err)
+	}
+}
+
+func TestAnnotateMigrated(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	source := testPVC("default", "data")
+	client := fake.NewSimpleClientset(source)
+
+	s.annotateMigrated(context.Background(), client, "default/data", *source, "target")
+	pvc, err := client.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "data", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pvc.Annotations["volume-sync/migrated-to"]; got != "target" {
+		t.Errorf("got migrated-to %q, want target", got)
+	}
+	if _, err := time.Parse(time.RFC3339, pvc.Annotations["volume-sync/migrated-at"]); err != nil {
+		t.Errorf("invalid migrated-at: %s", err)
+	}
+
+	// a pvc gone from the source is only logged
+	s.annotateMigrated(context.Background(), client, "default/gone", *testPVC("default", "gone"), "target")
+}
+
+func TestCheckTargetStorageClasses(t *testing.T) {
+	objects := []runtime.Object{
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "efs-sc"}, Provisioner: efsProvisioner},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "gp3"}, Provisioner: "ebs.csi.aws.com"},
+	}
+	sourcePVCs := map[string]v1.PersistentVolumeClaim{
+		"default/data": *testPVC("default", "data", withStorageClass("efs-sc")),
+	}
+	tests := []struct {
+		name         string
+		storageClass string
+		wantFailure  bool
+	}{
+		{"efs", "efs-sc", false},
+		{"same as source", "", false},
+		{"not efs", "gp3", true},
+		{"missing", "efs-missing", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, Opts{Quiet: true})
+			err := s.checkTargetStorageClasses(context.Background(), fake.NewSimpleClientset(objects...), "target", test.storageClass, sourcePVCs, true)
+			if (err != nil) != test.wantFailure {
+				t.Errorf("got %v, want failure %t", err, test.wantFailure)
+			}
+		})
+	}
+}
+
+func TestCheckTargetStorageClassesForbidden(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "storageclasses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(storagev1.Resource("storageclasses"), "efs-sc", errors.New("no access"))
+	})
+	sourcePVCs := map[string]v1.PersistentVolumeClaim{"default/data": *testPVC("default", "data")}
+
+	logs := captureOutput(t, s, func() {
+		if err := s.checkTargetStorageClasses(context.Background(), client, "target", "efs-sc", sourcePVCs, false); err != nil {
+			t.Errorf("got %v, want a warning only", err)
+		}
+	})
+	if !strings.Contains(logs, "Couldn't check storage class efs-sc on target") {
+		t.Errorf("warning not logged, got logs:\n%s", logs)
+	}
+	if err := s.checkTargetStorageClasses(context.Background(), client, "target", "efs-sc", sourcePVCs, true); !apierrors.IsForbidden(err) {
+		t.Errorf("got %v, want the forbidden error when required", err)
+	}
+}
+
+func TestStorageClassOf(t *testing.T) {
+	if got := storageClassOf(*testPVC("default", "data", withStorageClass("efs-sc"), withBetaStorageClass("beta-sc"))); got != "efs-sc" {
+		t.Errorf("got %q, want the spec's efs-sc", got)
+	}
+	if got := storageClassOf(*testPVC("default", "data", withStorageClass(""), withBetaStorageClass("beta-sc"))); got != "beta-sc" {
+		t.Errorf("got %q, want the annotation's beta-sc", got)
+	}
+	if got := storageClassOf(*testPVC("default", "data")); got != "" {
+		t.Errorf("got %q, want none", got)
+	}
+}
+
+func TestRsyncDirArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		opts Opts
+		want string
+	}{
+		{"default", "-rulpEto", Opts{Quiet: true}, "-rulpEto --stats /source/ /target/"},
+		{"quoted exclude", "-a --exclude='*.tmp'", Opts{Quiet: true}, "-a --exclude=*.tmp --stats /source/ /target/"},
+		{"whole file", "-rulpEto", Opts{Quiet: true, WholeFile: true}, "-rulpEto -W --stats /source/ /target/"},
+		{"dry-run", "-rulpEto", Opts{Quiet: true, DryRun: true}, "-rulpEto --dry-run --itemize-changes --stats /source/ /target/"},
+		{"delete", "-a", Opts{Quiet: true, DeleteExtraneous: true, DeleteAfter: true}, "-a --delete --delete-after --stats /source/ /target/"},
+		{"devices", "-rulpEto", Opts{Quiet: true, Devices: true}, "-rulpEto --devices --stats /source/ /target/"},
+		{"specials", "-rulpEto", Opts{Quiet: true, Specials: true}, "-rulpEto --specials --stats /source/ /target/"},
+		{"devices and specials", "-rulpEto", Opts{Quiet: true, Devices: true, Specials: true}, "-rulpEto --devices --specials --stats /source/ /target/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := test.opts
+			o.RsyncBinary = "rsync"
+			s := testSynchronizer(t, o)
+			calls := fakeCommand(t, "rsync", 0)
+			if _, err := s.rsyncDir(context.Background(), "/source/", "/target/", test.args, 1<<30); err != nil {
+				t.Fatal(err)
+			}
+			if got := fakeCalls(t, calls); len(got) != 1 || got[0] != test.want {
+				t.Errorf("got %q, want [%q]", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUseWholeFile(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		size int64
+		want bool
+	}{
+		{"default", Opts{}, 1 << 30, false},
+		{"whole file", Opts{WholeFile: true}, 1 << 40, true},
+		{"auto strategy, small volume", Opts{AutoStrategy: true}, 1 << 30, true},
+		{"auto strategy, big volume", Opts{AutoStrategy: true}, 10 << 30, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, test.opts)
+			s.autoStrategyThreshold = 10 << 30
+			if got := s.useWholeFile(test.size); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name string
+		dir  string
+		want bool
+	}{
+		{"empty", dir, true},
+		{"missing", filepath.Join(dir, "missing"), true},
+	} {
+		if got, err := isEmptyDir(test.dir); err != nil || got != test.want {
+			t.Errorf("%s: got %t, %v, want %t", test.name, got, err, test.want)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := isEmptyDir(dir); err != nil || got {
+		t.Errorf("got %t, %v with a file, want false", got, err)
+	}
+}
+
+func TestIsBlockVolume(t *testing.T) {
+	block, filesystem := v1.PersistentVolumeBlock, v1.PersistentVolumeFilesystem
+	tests := []struct {
+		name       string
+		volumeMode *v1.PersistentVolumeMode
+		want       bool
+	}{
+		{"unset", nil, false},
+		{"filesystem", &filesystem, false},
+		{"block", &block, true},
+	}
+	for _, test := range tests {
+		pvc := testPVC("default", "data")
+		pvc.Spec.VolumeMode = test.volumeMode
+		if got := isBlockVolume(*pvc); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+// conflicting makes the first n creations of pvcs on client fail with a
+// conflict.
+func conflicting(client *fake.Clientset, n int) {
+	client.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if n == 0 {
+			return false, nil, nil
+		}
+		n--
+		return true, nil, apierrors.NewConflict(v1.Resource("persistentvolumeclaims"), "data", errors.New("namespace is being changed"))
+	})
+}
+
+func TestCreateVPCRequeueOnConflict(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true, RequeueOnConflict: 2})
+	client := fake.NewSimpleClientset()
+	conflicting(client, 2)
+
+	name, err := s.createVPC(context.Background(), client, nil, "efs-target", false, "default/data", *testPVC("default", "data", withStorageClass("efs-sc")))
+	if err != nil || name != "default/data" {
+		t.Fatalf("got %q, %v, want default/data", name, err)
+	}
+	if _, err := client.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "data", metav1.GetOptions{}); err != nil {
+		t.Errorf("pvc not created: %s", err)
+	}
+}
+
+func TestCreateVPCConflictWithoutRequeue(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	client := fake.NewSimpleClientset()
+	conflicting(client, 1)
+
+	_, err := s.createVPC(context.Background(), client, nil, "efs-target", false, "default/data", *testPVC("default", "data", withStorageClass("efs-sc")))
+	if !apierrors.IsConflict(err) {
+		t.Errorf("got %v, want the conflict", err)
+	}
+}
+
+func TestCreateVPCSizeMismatch(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pvc := action.(k8stesting.CreateAction).GetObject().(*v1.PersistentVolumeClaim).DeepCopy()
+		pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("2Gi")
+		return true, pvc, nil
+	})
+
+	logs := captureOutput(t, s, func() {
+		s.createVPC(context.Background(), client, nil, "efs-target", false, "default/data", *testPVC("default", "data", withStorageClass("efs-sc")))
+	})
+	if want := "pvc default/data was created with a storage request of 2Gi instead of 1Gi"; !strings.Contains(logs, want) {
+		t.Errorf("got logs:\n%s\nwant %q", logs, want)
+	}
+}
+
+func TestCreateVPCTargetSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        string
+		want        string
+		wantFailure bool
+	}{
+		{"bigger", "5Gi", "5Gi", false},
+		{"same", "1Gi", "1Gi", false},
+		{"smaller", "500Mi", "", true},
+		{"invalid", "lots", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, Opts{Quiet: true})
+			client := fake.NewSimpleClientset()
+			source := testPVC("default", "data", withStorageClass("efs-sc"))
+			source.Annotations[targetSizeAnnotation] = test.size
+
+			_, err := s.createVPC(context.Background(), client, nil, "efs-target", false, "default/data", *source)
+			if (err != nil) != test.wantFailure {
+				t.Fatalf("got %v, want failure %t", err, test.wantFailure)
+			}
+			if err != nil {
+				return
+			}
+			target, err := client.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "data", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := target.Spec.Resources.Requests[v1.ResourceStorage]; got.String() != test.want {
+				t.Errorf("got request %s, want %s", got.String(), test.want)
+			}
+			if got := source.Spec.Resources.Requests[v1.ResourceStorage]; got.String() != "1Gi" {
+				t.Errorf("source request changed to %s", got.String())
+			}
+		})
+	}
+}
+
+func TestNeedsFileSystemId(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Opts
+		mountPath string
+		want      bool
+	}{
+		{"mounted by the run", Opts{}, "", true},
+		{"already mounted", Opts{}, "/mnt/efs", false},
+		{"already mounted, file systems from pvs", Opts{StorageClassFromPV: true}, "/mnt/efs", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSynchronizer(t, test.opts)
+			if got := s.needsFileSystemId(test.mountPath); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArchiveRsyncArgs(t *testing.T) {
+	if got := archiveRsyncArgs("-rulpEto", true); got != "-a" {
+		t.Errorf("got %q for the default arguments, want -a", got)
+	}
+	if got := archiveRsyncArgs("--exclude=.snapshot", false); got != "-a --exclude=.snapshot" {
+		t.Errorf("got %q, want -a and the given arguments", got)
+	}
+}
+
+func TestForbiddenGuidance(t *testing.T) {
+	quota := apierrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "data", errors.New("exceeded quota: storage, requested: requests.storage=1Gi"))
+	if got := forbiddenGuidance("apps", quota); !strings.Contains(got, "namespace apps on target is out of its ResourceQuota") {
+		t.Errorf("got %q, want the quota explained", got)
+	}
+	rbac := apierrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "data", errors.New(`User "ci" cannot create resource`))
+	if got := forbiddenGuidance("apps", rbac); !strings.Contains(got, "grant it create on persistentvolumeclaims there") {
+		t.Errorf("got %q, want the missing permission explained", got)
+	}
+}
+
+// forbiddenIn makes the creations of pvcs in namespace fail as forbidden.
+func forbiddenIn(client *fake.Clientset, namespace string) {
+	client.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != namespace {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "", errors.New("no access"))
+	})
+}
+
+func TestCreateMissingPVCsForbidden(t *testing.T) {
+	sourcePVCs := pvcMap(
+		testPVC("apps", "data", withStorageClass("efs-sc")),
+		testPVC("locked", "a", withStorageClass("efs-sc")),
+		testPVC("locked", "b", withStorageClass("efs-sc")),
+	)
+
+	t.Run("fail", func(t *testing.T) {
+		s := testSynchronizer(t, Opts{Quiet: true})
+		client := fake.NewSimpleClientset()
+		forbiddenIn(client, "locked")
+		_, err := s.createMissingPVCs(context.Background(), client, nil, "efs-target", false, sourcePVCs, map[string]v1.PersistentVolumeClaim{})
+		if !apierrors.IsForbidden(err) || !strings.Contains(err.Error(), "grant it create on persistentvolumeclaims") {
+			t.Errorf("got %v, want the forbidden error explained", err)
+		}
+	})
+	t.Run("skip namespace", func(t *testing.T) {
+		s := testSynchronizer(t, Opts{SkipForbiddenNamespaces: true})
+		client := fake.NewSimpleClientset()
+		forbiddenIn(client, "locked")
+		var created []string
+		var err error
+		logs := captureOutput(t, s, func() {
+			created, err = s.createMissingPVCs(context.Background(), client, nil, "efs-target", false, sourcePVCs, map[string]v1.PersistentVolumeClaim{})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"apps/data"}; !reflect.DeepEqual(created, want) {
+			t.Errorf("got created %v, want %v", created, want)
+		}
+		if got := strings.Count(logs, "Skipping namespace locked"); got != 1 {
+			t.Errorf("got namespace skipped %d times, want once, logs:\n%s", got, logs)
+		}
+	})
+}
+
+func TestCheckVolumeExists(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	client := fake.NewSimpleClientset(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-data"}})
+
+	if err := s.checkVolumeExists(context.Background(), client, "pv-data"); err != nil {
+		t.Errorf("got %v for an existing pv", err)
+	}
+	if err := s.checkVolumeExists(context.Background(), client, "pv-deleted"); err == nil || !strings.Contains(err.Error(), "pv pv-deleted which doesn't exist anymore") {
+		t.Errorf("got %v, want the deleted pv reported", err)
+	}
+
+	client.PrependReactor("get", "persistentvolumes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(v1.Resource("persistentvolumes"), "pv-data", errors.New("no access"))
+	})
+	var err error
+	logs := captureOutput(t, s, func() { err = s.checkVolumeExists(context.Background(), client, "pv-data") })
+	if err != nil {
+		t.Errorf("got %v for an unreadable pv, want it assumed to exist", err)
+	}
+	if !strings.Contains(logs, "Couldn't check pv pv-data exists") {
+		t.Errorf("warning not logged, got logs:\n%s", logs)
+	}
+}
+
+func TestUnboundVolumes(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	pvcsSource := pvcMap(
+		testPVC("default", "bound"),
+		testPVC("default", "source-pending", withPhase(v1.ClaimPending)),
+		testPVC("default", "target-pending"),
+		testPVC("default", "target-missing"),
+	)
+	pvcsTarget := pvcMap(
+		testPVC("default", "bound"),
+		testPVC("default", "source-pending"),
+		testPVC("default", "target-pending", withPhase(v1.ClaimPending)),
+	)
+
+	want := []string{"default/source-pending", "default/target-missing", "default/target-pending"}
+	if got := s.unboundVolumes(pvcsSource, pvcsTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// fakeRsync puts an rsync first in the PATH until the end of the test which,
+// like a fakeCommand, records its arguments in the returned file. It prints
+// output and, the first failures times it is passed the argument failing,
+// exits with 23.
+func fakeRsync(t *testing.T, output, failing string, failures int) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "rsync.calls")
+	failed := filepath.Join(dir, "rsync.failed")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %[1]s
+for arg; do
+	if [ -n %[3]q ] && [ "$arg" = %[3]q ] && [ $(wc -l < %[2]s 2>/dev/null || echo 0) -lt %[4]d ]; then
+		echo >> %[2]s
+		exit 23
+	fi
+done
+printf %%b %[5]q
+`, calls, failed, failing, failures, output)
+	if err := os.WriteFile(filepath.Join(dir, "rsync"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+// rsyncedFrom returns how many of the rsyncs of calls rsynced dirSource.
+func rsyncedFrom(t *testing.T, calls, dirSource string) int {
+	t.Helper()
+	count := 0
+	for _, call := range fakeCalls(t, calls) {
+		if slices.Contains(strings.Fields(call), dirSource) {
+			count++
+		}
+	}
+	return count
+}
+
+// testClusters returns a source cluster with pvcs and the storage class
+// efs-sc, and a target cluster running Kubernetes v1.30 with the storage
+// class efs-target.
+func testClusters(pvcs ...runtime.Object) (*fake.Clientset, *fake.Clientset) {
+	source := fake.NewSimpleClientset(append(pvcs,
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "efs-sc"}, Provisioner: efsProvisioner, Parameters: map[string]string{"fileSystemId": "fs-test-source"}},
+	)...)
+	target := fake.NewSimpleClientset(
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "efs-target"}, Provisioner: efsProvisioner, Parameters: map[string]string{"fileSystemId": "fs-test-target"}},
+	)
+	target.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.0"}
+	return source, target
+}
+
+// testRunOpts returns the default options changed by args, for a run from
+// the test source cluster to the test target cluster.
+func testRunOpts(t *testing.T, args ...string) *Opts {
+	t.Helper()
+	o := &Opts{}
+	_, err := flags.NewParser(o, flags.None).ParseArgs(append([]string{
+		"--sourceEKSContext=source", "--targetEKSContext=target",
+		"--sourceStorageClass=efs-sc", "--targetStorageClass=efs-target",
+		"--sourceEFSDNSName=fs-test-source.efs.eu-west-1.amazonaws.com", "--targetEFSDNSName=fs-test-target.efs.eu-west-1.amazonaws.com",
+	}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// runSynchronizer runs a Synchronizer configured by o against the fake
+// clients, with fake mount and umount commands, and returns its logs.
+func runSynchronizer(ctx context.Context, t *testing.T, o *Opts, source kubernetes.Interface, targets ...kubernetes.Interface) (*bytes.Buffer, error) {
+	t.Helper()
+	fakeCommand(t, "mount", 0)
+	fakeCommand(t, "umount", 0)
+	logs := &bytes.Buffer{}
+	t.Cleanup(func() {
+		os.RemoveAll("/tmp/source-fs-test-source")
+		os.RemoveAll("/tmp/target-fs-test-target")
+	})
+	err := (&Synchronizer{Opts: o, Source: source, Targets: targets, Logger: logs}).Run(ctx)
+	return logs, err
+}
+
+// bindTargets adds to target, for each of pvcs, a pvc of the target storage
+// class bound to a pv named after its source one.
+func bindTargets(t *testing.T, target *fake.Clientset, pvcs ...*v1.PersistentVolumeClaim) {
+	t.Helper()
+	for _, pvc := range pvcs {
+		targetPVC := testPVC(pvc.Namespace, pvc.Name, withStorageClass("efs-target"))
+		targetPVC.Spec.VolumeName = "target-" + pvc.Spec.VolumeName
+		for _, object := range []runtime.Object{targetPVC, &v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: targetPVC.Spec.VolumeName}}} {
+			if err := target.Tracker().Add(object); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	o := &Opts{}
+	s := New(o)
+	if s.Opts != o || s.Logger != os.Stdout || s.Source != nil || s.Targets != nil {
+		t.Errorf("got %+v, want the options logging to os.Stdout", s)
+	}
+}
+
+func TestRun(t *testing.T) {
+	a, b := testPVC("default", "a", withStorageClass("efs-sc")), testPVC("default", "b", withStorageClass("efs-sc"))
+	source, target := testClusters(a, b)
+	bindTargets(t, target, a, b)
+	calls := fakeRsync(t, "", "", 0)
+
+	if _, err := runSynchronizer(context.Background(), t, testRunOpts(t), source, target); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		want := " /tmp/source-fs-test-source/pv-" + name + "/ /tmp/target-fs-test-target/target-pv-" + name + "/"
+		if !slices.ContainsFunc(fakeCalls(t, calls), func(call string) bool { return strings.HasSuffix(call, want) }) {
+			t.Errorf("volume %s not rsynced to its target, got rsyncs %q", name, fakeCalls(t, calls))
+		}
+	}
+}
+
+func TestRunMountsTargetReadOnly(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantReadOnly bool
+	}{
+		{"sync", nil, false},
+		{"dry-run", []string{"--dryRun"}, true},
+		{"estimate", []string{"--estimate"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := testPVC("default", "a", withStorageClass("efs-sc"))
+			source, target := testClusters(a)
+			bindTargets(t, target, a)
+			fake := &fakeRunner{}
+			t.Cleanup(func() {
+				os.RemoveAll("/tmp/source-fs-test-source")
+				os.RemoveAll("/tmp/target-fs-test-target")
+			})
+
+			s := &Synchronizer{Opts: testRunOpts(t, test.args...), Source: source, Targets: []kubernetes.Interface{target}, Logger: io.Discard, Runner: fake}
+			if err := s.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			mounts := make(map[string][]string)
+			for _, call := range fake.calls {
+				if call[0] == "mount" {
+					mounts[call[len(call)-1]] = call
+				}
+			}
+			if source := mounts["/tmp/source-fs-test-source"]; !slices.Contains(source, "ro") {
+				t.Errorf("got source mount %q, want it read-only", source)
+			}
+			if target := mounts["/tmp/target-fs-test-target"]; target == nil || slices.Contains(target, "ro") != test.wantReadOnly {
+				t.Errorf("got target mount %q, want read-only %t", target, test.wantReadOnly)
+			}
+		})
+	}
+}
+
+func TestRunBindWaitInterval(t *testing.T) {
+	source, target := testClusters(testPVC("default", "data", withStorageClass("efs-sc")))
+	fakeRsync(t, "", "", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := runSynchronizer(ctx, t, testRunOpts(t, "--bindWaitInterval=1h"), source, target)
+	if ExitCode(err) != exitCluster || !strings.Contains(err.Error(), "Stopped waiting for pvs to be created") {
+		t.Errorf("got %v, want the wait for pvs stopped", err)
+	}
+	if _, err := target.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "data", metav1.GetOptions{}); err != nil {
+		t.Errorf("pvc not created before waiting: %s", err)
+	}
+}
+
+func TestRunBindMaxAttempts(t *testing.T) {
+	source, target := testClusters(testPVC("default", "data", withStorageClass("efs-sc")))
+	target.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// the pvc is created but not listed yet, as when the cache of the API
+		// server lags
+		return true, action.(k8stesting.CreateAction).GetObject(), nil
+	})
+	fakeRsync(t, "", "", 0)
+
+	started := time.Now()
+	logs, err := runSynchronizer(context.Background(), t, testRunOpts(t, "--bindWaitInterval=50ms", "--bindMaxAttempts=3"), source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(logs.String(), "creating missing PVCs on target, attempt"); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("got %s for 3 attempts, want --bindWaitInterval waited after each", elapsed)
+	}
+}
+
+func TestRunPhaseRetries(t *testing.T) {
+	a, b := testPVC("default", "a", withStorageClass("efs-sc")), testPVC("default", "b", withStorageClass("efs-sc"))
+	failing := "/tmp/source-fs-test-source/pv-b/"
+	tests := []struct {
+		name      string
+		args      []string
+		failures  int
+		wantCalls int
+		wantCode  int
+	}{
+		{"no retry", nil, 1, 1, exitRsync},
+		{"recovered", []string{"--phaseRetries=3", "--phaseRetryBackoff=1ms"}, 1, 2, exitOK},
+		{"still failing", []string{"--phaseRetries=2", "--phaseRetryBackoff=1ms"}, 10, 3, exitRsync},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, target := testClusters(a, b)
+			bindTargets(t, target, a, b)
+			calls := fakeRsync(t, "", failing, test.failures)
+
+			_, err := runSynchronizer(context.Background(), t, testRunOpts(t, test.args...), source, target)
+			if ExitCode(err) != test.wantCode {
+				t.Errorf("got %v, want exit code %d", err, test.wantCode)
+			}
+			if got := rsyncedFrom(t, calls, failing); got != test.wantCalls {
+				t.Errorf("got %d rsyncs of the failing volume, want %d", got, test.wantCalls)
+			}
+			if got := rsyncedFrom(t, calls, "/tmp/source-fs-test-source/pv-a/"); got != 1 {
+				t.Errorf("got %d rsyncs of the synchronized volume, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSynchronizerGetPVCs(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testPVC("default", "data", withStorageClass("efs-sc")),
+		testPVC("default", "logs", withStorageClass("efs-sc")),
+		testPVC("other", "data", withStorageClass("efs-sc")),
+	)
+	s := &Synchronizer{Opts: &Opts{PvcIncludeNamespaceRegex: "^default$", PvcIncludeNameRegex: "^data$"}, Logger: &bytes.Buffer{}}
+
+	pvcs, err := s.GetPVCs(context.Background(), client, "source", "efs-sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(pvcs), []string{"default/data"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	s.Opts.PvcIncludeNameRegex = "("
+	if _, err := s.GetPVCs(context.Background(), client, "source", "efs-sc"); ExitCode(err) != exitConfig {
+		t.Errorf("got %v for an invalid regex, want a config error", err)
+	}
+}
+
+func TestSynchronizerCreateMissingPVCs(t *testing.T) {
+	_, target := testClusters()
+	s := &Synchronizer{Opts: &Opts{BetaAnnotation: "auto"}, Logger: &bytes.Buffer{}}
+	sourcePVCs := pvcMap(testPVC("default", "data", withBetaStorageClass("efs-sc")), testPVC("default", "logs", withStorageClass("efs-sc")))
+	targetPVCs := pvcMap(testPVC("default", "logs", withStorageClass("efs-target")))
+
+	created, err := s.CreateMissingPVCs(context.Background(), target, "efs-target", sourcePVCs, targetPVCs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default/data"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("got %v created, want %v", created, want)
+	}
+	pvc, err := target.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "data", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pvc.Spec.StorageClassName; got == nil || *got != "efs-target" {
+		t.Errorf("got spec.storageClassName %v, want efs-target", got)
+	}
+	if _, ok := pvc.Annotations[betaStorageClassAnnotation]; ok {
+		t.Error("beta annotation kept on a v1.30 target")
+	}
+}
+
+func TestSynchronizerRsyncDir(t *testing.T) {
+	s := &Synchronizer{Opts: &Opts{RsyncBinary: "rsync", RsyncArgs: "-a", IntraVolumeParallelism: 1}, Logger: &bytes.Buffer{}}
+	source, target := t.TempDir()+"/", t.TempDir()+"/"
+	calls := fakeRsync(t, "", source, 1)
+
+	if err := s.RsyncDir(context.Background(), source, target, 0); err == nil {
+		t.Error("got nil for a failed rsync, want an error")
+	}
+	if err := s.RsyncDir(context.Background(), source, target, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "-a --stats " + source + " " + target
+	if got := fakeCalls(t, calls); len(got) != 2 || got[1] != want {
+		t.Errorf("got rsyncs %q, want [%q]", got, want)
+	}
+}
+
+// targetPVCs returns the pvcs of the target storage class on target.
+func targetPVCs(t *testing.T, target kubernetes.Interface) map[string]v1.PersistentVolumeClaim {
+	t.Helper()
+	pvcs, err := testSynchronizer(t, Opts{Quiet: true}).GetPVCs(context.Background(), target, "target", "efs-target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pvcs
+}
+
+func TestSynchronizerRsyncDirs(t *testing.T) {
+	a, b := testPVC("default", "a", withStorageClass("efs-sc")), testPVC("default", "b", withStorageClass("efs-sc"))
+	source, target := testClusters(a, b)
+	bindTargets(t, target, a)
+	s, fake, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", RsyncArgs: "-a", Parallelism: 2, IntraVolumeParallelism: 1})
+	sourcePath, targetPath := t.TempDir(), t.TempDir()
+
+	pending, err := s.RsyncDirs(context.Background(), source, target, sourcePath, targetPath, pvcMap(a, b), targetPVCs(t, target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default/b"}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("got pending %v, want %v", pending, want)
+	}
+	want := []string{"rsync", "-a", "--stats", sourcePath + "/pv-a/", targetPath + "/target-pv-a/"}
+	if len(fake.calls) != 1 || !reflect.DeepEqual(fake.calls[0], want) {
+		t.Errorf("got commands %q, want %q", fake.calls, want)
+	}
+}
+
+func TestSynchronizersWithDifferentOpts(t *testing.T) {
+	a := testPVC("default", "a", withStorageClass("efs-sc"))
+	source, target := testClusters(a)
+	bindTargets(t, target, a)
+	pvcs := targetPVCs(t, target)
+	sourcePath, targetPath := t.TempDir(), t.TempDir()
+	tests := []struct {
+		opts        Opts
+		want        []string
+		wantDryRun  bool
+		wantSummary string
+	}{
+		{Opts{RsyncBinary: "rsync", RsyncArgs: "-a", Parallelism: 1, IntraVolumeParallelism: 1}, []string{"rsync", "-a", "--stats"}, false, "Successfully rsync"},
+		{Opts{RsyncBinary: "/opt/rsync/bin/rsync", RsyncArgs: "-rlt", WholeFile: true, DryRun: true, Parallelism: 1, IntraVolumeParallelism: 1}, []string{"/opt/rsync/bin/rsync", "-rlt", "-W", "--dry-run", "--itemize-changes", "--stats"}, true, "Planned transfers"},
+	}
+	synchronizers := make([]*Synchronizer, len(tests))
+	fakes := make([]*fakeRunner, len(tests))
+	logs := make([]*bytes.Buffer, len(tests))
+	for i, test := range tests {
+		synchronizers[i], fakes[i], logs[i] = testFakeRunner(t, &test.opts)
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range synchronizers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.RsyncDirs(context.Background(), source, target, sourcePath, targetPath, pvcMap(a), pvcs); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i, test := range tests {
+		want := append(test.want, sourcePath+"/pv-a/", targetPath+"/target-pv-a/")
+		if len(fakes[i].calls) != 1 || !reflect.DeepEqual(fakes[i].calls[0], want) {
+			t.Errorf("synchronizer %d: got commands %q, want %q", i, fakes[i].calls, want)
+		}
+		if got := strings.Contains(logs[i].String(), "[DRY RUN]"); got != test.wantDryRun {
+			t.Errorf("synchronizer %d: got dry-run logs %t, want %t:\n%s", i, got, test.wantDryRun, logs[i])
+		}
+		if !strings.Contains(logs[i].String(), test.wantSummary) {
+			t.Errorf("synchronizer %d: %q not logged, got logs:\n%s", i, test.wantSummary, logs[i])
+		}
+	}
+}
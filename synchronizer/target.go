@@ -0,0 +1,119 @@
+package synchronizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// target is a cluster the source volumes are synchronized to.
+type target struct {
+	context      string
+	efsDNSName   string
+	mountPath    string
+	storageClass string
+	awsProfile   string
+	caFile       string
+	client       kubernetes.Interface
+	recorder     record.EventRecorder
+	fileSystems  *fileSystems
+	pvcs         map[string]v1.PersistentVolumeClaim
+	unbound      []string
+	// created holds the namespace/name of the pvcs this run created, to tell
+	// them apart from the ones that already existed.
+	created map[string]bool
+	// recreated holds the namespace/name of the pvcs deleted to be created
+	// again by --onImmutableConflict=recreate.
+	recreated []string
+	// conflicts holds, by source namespace/name, the pvcs skipped by
+	// --onImmutableConflict=skip and why.
+	conflicts map[string]string
+	// stripBetaAnnotation is set when the created pvcs don't get the
+	// deprecated beta storage class annotation.
+	stripBetaAnnotation bool
+}
+
+// buildTargets pairs the repeated target flags. Each target needs its own EFS
+// DNS name, or mount path when it is already mounted, while a single storage
+// class can be shared by all of them.
+func buildTargets(opts *Opts) ([]*target, error) {
+	contexts := opts.TargetEKSContext
+	if len(opts.TargetEFSDNSName) != 0 && len(opts.TargetEFSDNSName) != len(contexts) {
+		return nil, configError("parse error", fmt.Errorf("got %d --targetEFSDNSName for %d --targetEKSContext, expected one per context", len(opts.TargetEFSDNSName), len(contexts)))
+	}
+	if len(opts.TargetMountPath) != 0 && len(opts.TargetMountPath) != len(contexts) {
+		return nil, configError("parse error", fmt.Errorf("got %d --targetMountPath for %d --targetEKSContext, expected one per context", len(opts.TargetMountPath), len(contexts)))
+	}
+	if len(opts.TargetStorageClass) != 1 && len(opts.TargetStorageClass) != len(contexts) {
+		return nil, configError("parse error", fmt.Errorf("got %d --targetStorageClass for %d --targetEKSContext, expected one or one per context", len(opts.TargetStorageClass), len(contexts)))
+	}
+	if len(opts.TargetAwsProfile) > 1 && len(opts.TargetAwsProfile) != len(contexts) {
+		return nil, configError("parse error", fmt.Errorf("got %d --targetAwsProfile for %d --targetEKSContext, expected one or one per context", len(opts.TargetAwsProfile), len(contexts)))
+	}
+
+	if len(opts.TargetCAFile) > 1 && len(opts.TargetCAFile) != len(contexts) {
+		return nil, configError("parse error", fmt.Errorf("got %d --targetCAFile for %d --targetEKSContext, expected one or one per context", len(opts.TargetCAFile), len(contexts)))
+	}
+
+	targets := make([]*target, 0, len(contexts))
+	for i, context := range contexts {
+		target := &target{
+			context:      context,
+			storageClass: opts.TargetStorageClass[0],
+			created:      make(map[string]bool),
+			conflicts:    make(map[string]string),
+		}
+		if len(opts.TargetStorageClass) > 1 {
+			target.storageClass = opts.TargetStorageClass[i]
+		}
+		if len(opts.TargetAwsProfile) == 1 {
+			target.awsProfile = opts.TargetAwsProfile[0]
+		} else if len(opts.TargetAwsProfile) > 1 {
+			target.awsProfile = opts.TargetAwsProfile[i]
+		}
+		if len(opts.TargetCAFile) == 1 {
+			target.caFile = opts.TargetCAFile[0]
+		} else if len(opts.TargetCAFile) > 1 {
+			target.caFile = opts.TargetCAFile[i]
+		}
+		if len(opts.TargetEFSDNSName) > 0 {
+			target.efsDNSName = opts.TargetEFSDNSName[i]
+		}
+		if len(opts.TargetMountPath) > 0 {
+			target.mountPath = opts.TargetMountPath[i]
+		}
+		if target.efsDNSName == "" && target.mountPath == "" && opts.Region == "" {
+			return nil, configError("parse error", fmt.Errorf("target %s needs either --targetEFSDNSName, --targetMountPath or --region", context))
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// checkTargetContextAllowed returns an error unless context matches one of
+// the allowed glob patterns, a guardrail against pointing a run at the wrong
+// cluster.
+func checkTargetContextAllowed(context string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range allowed {
+		if globMatch(pattern, context) {
+			return nil
+		}
+	}
+	return configError("Target context not allowed", fmt.Errorf("%s doesn't match --allowedTargetContexts %s", context, strings.Join(allowed, ", ")))
+}
+
+// globMatch tells whether name matches pattern, where * matches any run of
+// characters, slashes of EKS ARNs included, and ? any single character.
+func globMatch(pattern, name string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+	return regexp.MustCompile("^" + expression + "$").MatchString(name)
+}
@@ -0,0 +1,110 @@
+package synchronizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+		want []target
+	}{
+		{
+			name: "one target",
+			opts: Opts{TargetEKSContext: []string{"prod"}, TargetEFSDNSName: []string{"fs-1.efs"}, TargetStorageClass: []string{"efs-sc"}},
+			want: []target{{context: "prod", efsDNSName: "fs-1.efs", storageClass: "efs-sc"}},
+		},
+		{
+			name: "shared storage class and profile",
+			opts: Opts{
+				TargetEKSContext:   []string{"prod", "dr"},
+				TargetEFSDNSName:   []string{"fs-1.efs", "fs-2.efs"},
+				TargetStorageClass: []string{"efs-sc"},
+				TargetAwsProfile:   []string{"admin"},
+			},
+			want: []target{
+				{context: "prod", efsDNSName: "fs-1.efs", storageClass: "efs-sc", awsProfile: "admin"},
+				{context: "dr", efsDNSName: "fs-2.efs", storageClass: "efs-sc", awsProfile: "admin"},
+			},
+		},
+		{
+			name: "one storage class and mount path per target",
+			opts: Opts{
+				TargetEKSContext:   []string{"prod", "dr"},
+				TargetMountPath:    []string{"/mnt/prod", "/mnt/dr"},
+				TargetStorageClass: []string{"efs-prod", "efs-dr"},
+			},
+			want: []target{
+				{context: "prod", mountPath: "/mnt/prod", storageClass: "efs-prod"},
+				{context: "dr", mountPath: "/mnt/dr", storageClass: "efs-dr"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := buildTargets(&test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]target, 0, len(test.opts.TargetEKSContext))
+			for _, target := range targets {
+				target.created, target.conflicts = nil, nil
+				got = append(got, *target)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildTargetsMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Opts
+	}{
+		{"dns names", Opts{TargetEKSContext: []string{"prod", "dr"}, TargetEFSDNSName: []string{"fs-1.efs"}, TargetStorageClass: []string{"efs-sc"}}},
+		{"mount paths", Opts{TargetEKSContext: []string{"prod", "dr"}, TargetMountPath: []string{"/mnt/prod"}, TargetStorageClass: []string{"efs-sc"}}},
+		{"storage classes", Opts{TargetEKSContext: []string{"prod", "dr", "qa"}, TargetEFSDNSName: []string{"a", "b", "c"}, TargetStorageClass: []string{"efs-prod", "efs-dr"}}},
+		{"aws profiles", Opts{TargetEKSContext: []string{"prod", "dr", "qa"}, TargetEFSDNSName: []string{"a", "b", "c"}, TargetStorageClass: []string{"efs-sc"}, TargetAwsProfile: []string{"a", "b"}}},
+		{"no file system", Opts{TargetEKSContext: []string{"prod"}, TargetStorageClass: []string{"efs-sc"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := buildTargets(&test.opts); ExitCode(err) != exitConfig {
+				t.Errorf("got %v, want a config error", err)
+			}
+		})
+	}
+}
+
+func TestCheckTargetContextAllowed(t *testing.T) {
+	allowed := []string{"arn:aws:eks:*:123456789012:cluster/prod-*", "staging?"}
+	tests := []struct {
+		context string
+		want    bool
+	}{
+		{"arn:aws:eks:eu-west-1:123456789012:cluster/prod-new", true},
+		{"arn:aws:eks:eu-west-1:210987654321:cluster/prod-new", false},
+		{"staging2", true},
+		{"staging", false},
+		{"staging22", false},
+	}
+	for _, test := range tests {
+		err := checkTargetContextAllowed(test.context, allowed)
+		if (err == nil) != test.want || (err != nil && ExitCode(err) != exitConfig) {
+			t.Errorf("%s: got %v, want allowed %t", test.context, err, test.want)
+		}
+	}
+	if err := checkTargetContextAllowed("anything", nil); err != nil {
+		t.Errorf("got %v without --allowedTargetContexts", err)
+	}
+}
+
+func TestGlobMatchQuotesMeta(t *testing.T) {
+	if globMatch("prod.eu", "prod-eu") {
+		t.Error("a dot matches any character")
+	}
+}
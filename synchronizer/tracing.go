@@ -0,0 +1,53 @@
+package synchronizer
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/felipempda/eks-volume-synchronizer"
+
+// initTracing exports spans through OTLP/HTTP to endpoint (e.g.
+// http://localhost:4318) and returns a function flushing them. Without an
+// endpoint the global no-op tracer is kept.
+func (s *Synchronizer) initTracing(endpoint string) (shutdown func(), err error) {
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, configError("Couldn't create the OTLP exporter for "+endpoint, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("eks-volume-synchronizer"))),
+	)
+	otel.SetTracerProvider(provider)
+	return func() {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			s.log("Couldn't flush traces: " + err.Error())
+		}
+	}, nil
+}
+
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends span, marking it as failed when err isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,79 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, run := startSpan(context.Background(), "run")
+	_, volume := startSpan(ctx, "rsync", attribute.String("pvc", "default/data"))
+	endSpan(volume, errors.New("rsync exited with 23"))
+	endSpan(run, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	failed, succeeded := spans[0], spans[1]
+	if failed.Name() != "rsync" || failed.Parent().SpanID() != succeeded.SpanContext().SpanID() {
+		t.Errorf("got span %s of parent %s, want rsync under run", failed.Name(), failed.Parent().SpanID())
+	}
+	if failed.Status().Code != codes.Error || failed.Status().Description != "rsync exited with 23" || len(failed.Events()) != 1 {
+		t.Errorf("got status %+v and %d events, want the error recorded", failed.Status(), len(failed.Events()))
+	}
+	if got := failed.Attributes(); len(got) != 1 || got[0] != attribute.String("pvc", "default/data") {
+		t.Errorf("got attributes %v, want pvc=default/data", got)
+	}
+	if succeeded.Status().Code != codes.Unset {
+		t.Errorf("got status %+v, want unset", succeeded.Status())
+	}
+}
+
+func TestInitTracingWithoutEndpoint(t *testing.T) {
+	s := testSynchronizer(t, Opts{})
+	shutdown, err := s.initTracing("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdown()
+}
+
+func TestRsyncVolumeSpanThroughput(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	a := testPVC("default", "a", withStorageClass("efs-sc"))
+	source, target := testClusters(a)
+	bindTargets(t, target, a)
+	s, fake, _ := testFakeRunner(t, &Opts{RsyncBinary: "rsync", RsyncArgs: "-a", Parallelism: 1, IntraVolumeParallelism: 1})
+	fake.output = []byte(rsync3Stats)
+
+	if _, err := s.RsyncDirs(context.Background(), source, target, t.TempDir(), t.TempDir(), pvcMap(a), targetPVCs(t, target)); err != nil {
+		t.Fatal(err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "rsync-volume" {
+		t.Fatalf("got %d spans, want a rsync-volume one", len(spans))
+	}
+	attributes := attribute.NewSet(spans[0].Attributes()...)
+	if got, _ := attributes.Value("transferred_bytes"); got.AsInt64() != 2048 {
+		t.Errorf("got transferred_bytes %v, want 2048", got.Emit())
+	}
+	if got, ok := attributes.Value("throughput_mbps"); !ok || got.AsFloat64() <= 0 {
+		t.Errorf("got throughput_mbps %v, want the rate of the 2048 bytes", got.Emit())
+	}
+}
@@ -0,0 +1,61 @@
+package synchronizer
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// entryCounts are the numbers of files and directories found under a dir.
+type entryCounts struct {
+	files int
+	dirs  int
+}
+
+// countEntries walks dir and counts the files, of any type, and the
+// directories under it, dir itself excluded.
+func countEntries(dir string) (entryCounts, error) {
+	var counts entryCounts
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if entry.IsDir() {
+			counts.dirs++
+		} else {
+			counts.files++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// verifyCounts compares the number of files and directories of dirSource and
+// dirTarget, a cheap check that the volume was fully copied. Each count may
+// differ by up to tolerance entries.
+func (s *Synchronizer) verifyCounts(dirSource, dirTarget string, tolerance int) error {
+	source, err := countEntries(dirSource)
+	if err != nil {
+		return fmt.Errorf("couldn't count entries of %s: %w", dirSource, err)
+	}
+	target, err := countEntries(dirTarget)
+	if err != nil {
+		return fmt.Errorf("couldn't count entries of %s: %w", dirTarget, err)
+	}
+	if abs(source.files-target.files) > tolerance || abs(source.dirs-target.dirs) > tolerance {
+		return fmt.Errorf("%s has %d files and %d dirs but %s has %d files and %d dirs",
+			dirSource, source.files, source.dirs, dirTarget, target.files, target.dirs)
+	}
+	s.log(fmt.Sprintf("%s and %s both have %d files and %d dirs, within %d", dirSource, dirTarget, target.files, target.dirs, tolerance))
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
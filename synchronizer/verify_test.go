@@ -0,0 +1,41 @@
+package synchronizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountEntries(t *testing.T) {
+	dir, _ := sampleTree(t)
+
+	counts, err := countEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (entryCounts{files: 6, dirs: 2}); counts != want {
+		t.Errorf("got %+v, want %+v", counts, want)
+	}
+}
+
+func TestVerifyCounts(t *testing.T) {
+	s := testSynchronizer(t, Opts{Quiet: true})
+	source, _ := sampleTree(t)
+	target, _ := sampleTree(t)
+	if err := s.verifyCounts(source, target, 0); err != nil {
+		t.Errorf("got %v for the same trees", err)
+	}
+
+	if err := os.Remove(filepath.Join(target, "z.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifyCounts(source, target, 0); err == nil {
+		t.Error("got no error for a missing file")
+	}
+	if err := s.verifyCounts(source, target, 1); err != nil {
+		t.Errorf("got %v for a missing file within the tolerance", err)
+	}
+	if err := s.verifyCounts(source, filepath.Join(target, "missing"), 1); err == nil {
+		t.Error("got no error for a missing target")
+	}
+}
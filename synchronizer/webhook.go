@@ -0,0 +1,134 @@
+package synchronizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// webhookAttempts is how many times the summary is posted to
+// --summaryWebhook when it fails transiently, waiting webhookBackoff, doubled
+// every time, in between.
+const webhookAttempts = 4
+
+var webhookBackoff = time.Second
+
+// webhookTimeout bounds every POST to --summaryWebhook.
+const webhookTimeout = 30 * time.Second
+
+// webhookFuncs are the functions of --summaryWebhookTemplate besides the
+// built-in ones: json quotes a value, e.g. the error of the run, for a JSON
+// payload.
+var webhookFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		out, err := json.Marshal(value)
+		return string(out), err
+	},
+}
+
+// parseWebhookTemplate parses --summaryWebhookTemplate, nil when empty.
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	parsed, err := template.New("summaryWebhookTemplate").Funcs(webhookFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, configError("Invalid --summaryWebhookTemplate", err)
+	}
+	return parsed, nil
+}
+
+// summaryPayload returns the body posted to --summaryWebhook: report as JSON
+// or, with --summaryWebhookTemplate, the template executed with report.
+func (s *Synchronizer) summaryPayload(report *SyncReport) ([]byte, error) {
+	webhookTemplate, err := parseWebhookTemplate(s.Opts.SummaryWebhookTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if webhookTemplate == nil {
+		return json.Marshal(report)
+	}
+	var payload bytes.Buffer
+	if err := webhookTemplate.Execute(&payload, report); err != nil {
+		return nil, configError("Couldn't execute --summaryWebhookTemplate", err)
+	}
+	return payload.Bytes(), nil
+}
+
+// sendSummary posts the report of the run ended by err to --summaryWebhook.
+func (s *Synchronizer) sendSummary(err error) error {
+	s.report.mu.Lock()
+	s.finishReport(err)
+	payload, err := s.summaryPayload(s.report)
+	s.report.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.postSummary(s.Opts.SummaryWebhook, payload)
+}
+
+// postSummary posts payload to webhookURL, retrying with backoff on network
+// errors and on 429 and 5xx responses.
+func (s *Synchronizer) postSummary(webhookURL string, payload []byte) error {
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := postJSON(webhookURL, payload)
+		if err == nil {
+			s.log("summary posted to " + redactURL(webhookURL))
+			return nil
+		}
+		if !retry || attempt == webhookAttempts {
+			return err
+		}
+		s.warn(fmt.Sprintf("Couldn't post the summary to %s, retrying in %s (%d/%d): %s", redactURL(webhookURL), backoff, attempt, webhookAttempts-1, err))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postJSON posts body to webhookURL and tells, when it fails, whether it is
+// worth retrying.
+func postJSON(webhookURL string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		// the error names the URL, whose path may hold a token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500, errors.New(response.Status)
+}
+
+// redactURL keeps the scheme and the host of rawURL, as webhook URLs, e.g. of
+// Slack, hold their token in the path.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "REDACTED"
+	}
+	if parsed.Path == "" && parsed.RawQuery == "" && parsed.User == nil {
+		return parsed.Scheme + "://" + parsed.Host
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/REDACTED"
+}
@@ -0,0 +1,169 @@
+package synchronizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer records the bodies posted to it, answering the first
+// statuses in turn then 200.
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+	server := &webhookServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		server.bodies = append(server.bodies, string(body))
+		if len(server.statuses) > 0 {
+			w.WriteHeader(server.statuses[0])
+			server.statuses = server.statuses[1:]
+		}
+	}))
+	t.Cleanup(server.Close)
+	backoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = backoff })
+	return server
+}
+
+func TestRunSummaryWebhook(t *testing.T) {
+	a := testPVC("default", "a", withStorageClass("efs-sc"))
+	source, target := testClusters(a)
+	bindTargets(t, target, a)
+	fakeRsync(t, "", "", 0)
+	server := newWebhookServer(t)
+
+	if _, err := runSynchronizer(context.Background(), t, testRunOpts(t, "--summaryWebhook="+server.URL+"/hooks/T000/B000/secret"), source, target); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.bodies) != 1 {
+		t.Fatalf("got %d posts, want 1", len(server.bodies))
+	}
+	var posted SyncReport
+	if err := json.Unmarshal([]byte(server.bodies[0]), &posted); err != nil {
+		t.Fatal(err)
+	}
+	if len(posted.Targets) != 1 || len(posted.Targets[0].Volumes) != 1 || posted.Targets[0].Volumes[0].PVC != "default/a" || !posted.Targets[0].Volumes[0].Synced {
+		t.Errorf("got summary %s, want default/a synchronized", server.bodies[0])
+	}
+	if posted.ExitCode != exitOK || posted.End.IsZero() {
+		t.Errorf("got exit code %d and end %s, want the run over", posted.ExitCode, posted.End)
+	}
+}
+
+func TestSummaryWebhookTemplate(t *testing.T) {
+	server := newWebhookServer(t)
+	s := testSynchronizer(t, Opts{Quiet: true, SummaryWebhook: server.URL, SummaryWebhookTemplate: `{"text": "exit code {{.ExitCode}}", "error": {{json .Error}}}`})
+
+	if err := s.sendSummary(rsyncError("Couldn't rsync 1 volumes to target", errors.New(`default/"a"`))); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"text": "exit code 4", "error": "Couldn't rsync 1 volumes to target: default/\"a\""}`
+	if len(server.bodies) != 1 || server.bodies[0] != want {
+		t.Errorf("got %q, want %q", server.bodies, want)
+	}
+}
+
+func TestSummaryWebhookRetries(t *testing.T) {
+	server := newWebhookServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	s := testSynchronizer(t, Opts{Quiet: true, SummaryWebhook: server.URL})
+
+	logs := captureOutput(t, s, func() {
+		if err := s.sendSummary(nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if len(server.bodies) != 3 {
+		t.Errorf("got %d posts, want 2 retries", len(server.bodies))
+	}
+	if !strings.Contains(logs, "retrying in 2ms (2/3): 429 Too Many Requests") {
+		t.Errorf("retries not logged, got logs:\n%s", logs)
+	}
+}
+
+func TestSummaryWebhookFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     string
+		posts    int
+	}{
+		{"client error", []int{http.StatusForbidden}, "403 Forbidden", 1},
+		{"server errors", []int{500, 502, 503, 504}, "504 Gateway Timeout", webhookAttempts},
+	}
+	for _, test := range tests {
+		server := newWebhookServer(t, test.statuses...)
+		s := testSynchronizer(t, Opts{Quiet: true, SummaryWebhook: server.URL})
+
+		var err error
+		captureOutput(t, s, func() { err = s.sendSummary(nil) })
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.name, err, test.want)
+		}
+		if len(server.bodies) != test.posts {
+			t.Errorf("%s: got %d posts, want %d", test.name, len(server.bodies), test.posts)
+		}
+	}
+}
+
+func TestSummaryWebhookUnreachable(t *testing.T) {
+	server := newWebhookServer(t)
+	s := testSynchronizer(t, Opts{Quiet: true, SummaryWebhook: server.URL + "/hooks/secret"})
+	server.Close()
+
+	var err error
+	logs := captureOutput(t, s, func() { err = s.sendSummary(nil) })
+	if err == nil {
+		t.Fatal("got no error posting to a closed server")
+	}
+	if strings.Contains(err.Error()+logs, "secret") {
+		t.Errorf("webhook path logged, got %v and logs:\n%s", err, logs)
+	}
+}
+
+func TestCheckArgsWebhookTemplate(t *testing.T) {
+	if err := checkArgs(&Opts{SummaryWebhookTemplate: `{"text": {{.Error}`}); ExitCode(err) != exitConfig {
+		t.Errorf("got %v, want a config error", err)
+	}
+	if err := checkArgs(&Opts{SummaryWebhookTemplate: `{"text": {{json .Error}}}`}); err != nil {
+		t.Errorf("got %v, want none", err)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://hooks.slack.com/services/T000/B000/XXXX", "https://hooks.slack.com/REDACTED"},
+		{"https://chat.example/hook?token=XXXX", "https://chat.example/REDACTED"},
+		{"http://localhost:8080", "http://localhost:8080"},
+		{"not a url", "REDACTED"},
+	}
+	for _, test := range tests {
+		if got := redactURL(test.url); got != test.want {
+			t.Errorf("redactURL(%q): got %q, want %q", test.url, got, test.want)
+		}
+	}
+	if got := resolvedConfig(&Opts{SummaryWebhook: "https://hooks.slack.com/services/T000/B000/XXXX"})["summaryWebhook"]; got != "https://hooks.slack.com/REDACTED" {
+		t.Errorf("got summaryWebhook %v in the resolved config, want it redacted", got)
+	}
+}
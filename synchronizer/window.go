@@ -0,0 +1,69 @@
+package synchronizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// windowAnnotation on a source PVC restricts its synchronization to a daily
+// maintenance window, e.g. "02:00-04:00"
+const windowAnnotation = "volume-sync/window"
+
+// inWindow tells whether now, in the location of now, is within window
+// (HH:MM-HH:MM). Windows ending before they start span midnight.
+func inWindow(window string, now time.Time) (bool, error) {
+	start, end, ok := strings.Cut(window, "-")
+	if !ok {
+		return false, fmt.Errorf("%q isn't of the form HH:MM-HH:MM", window)
+	}
+	startMinute, err := minuteOfDay(start)
+	if err != nil {
+		return false, err
+	}
+	endMinute, err := minuteOfDay(end)
+	if err != nil {
+		return false, err
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if startMinute <= endMinute {
+		return startMinute <= minute && minute < endMinute, nil
+	}
+	return minute >= startMinute || minute < endMinute, nil
+}
+
+func minuteOfDay(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// limitToWindows keeps the pvcs without a windowAnnotation or whose window
+// includes now and returns the keys of the others, left for a later run.
+func limitToWindows(pvcs map[string]v1.PersistentVolumeClaim, now time.Time) (map[string]v1.PersistentVolumeClaim, []string, error) {
+	limited := make(map[string]v1.PersistentVolumeClaim)
+	outside := make([]string, 0)
+	for key, pvc := range pvcs {
+		window, ok := pvc.ObjectMeta.Annotations[windowAnnotation]
+		if !ok {
+			limited[key] = pvc
+			continue
+		}
+		in, err := inWindow(window, now)
+		if err != nil {
+			return nil, nil, configError(fmt.Sprintf("Invalid %s annotation on pvc %s", windowAnnotation, key), err)
+		}
+		if !in {
+			outside = append(outside, key)
+			continue
+		}
+		limited[key] = pvc
+	}
+	sort.Strings(outside)
+	return limited, outside, nil
+}
@@ -0,0 +1,64 @@
+package synchronizer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", "2026-10-17 "+clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		window string
+		now    string
+		want   bool
+	}{
+		{"02:00-04:00", "02:00", true},
+		{"02:00-04:00", "03:59", true},
+		{"02:00-04:00", "04:00", false},
+		{"02:00-04:00", "01:59", false},
+		{"22:00-02:00", "23:30", true},
+		{"22:00-02:00", "01:00", true},
+		{"22:00-02:00", "12:00", false},
+		{" 02:00 - 04:00 ", "03:00", true},
+	}
+	for _, test := range tests {
+		if got, err := inWindow(test.window, at(test.now)); err != nil || got != test.want {
+			t.Errorf("inWindow(%q) at %s = %t, %v, want %t", test.window, test.now, got, err, test.want)
+		}
+	}
+	for _, invalid := range []string{"02:00", "2am-4am", "02:00-25:00"} {
+		if _, err := inWindow(invalid, at("03:00")); err == nil {
+			t.Errorf("got no error for %q", invalid)
+		}
+	}
+}
+
+func TestLimitToWindows(t *testing.T) {
+	now := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	inside, outside, always := testPVC("default", "inside"), testPVC("default", "outside"), testPVC("default", "always")
+	inside.Annotations[windowAnnotation] = "02:00-04:00"
+	outside.Annotations[windowAnnotation] = "22:00-02:00"
+
+	limited, skipped, err := limitToWindows(pvcMap(inside, outside, always), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(limited), []string{"default/always", "default/inside"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if want := []string{"default/outside"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got skipped %v, want %v", skipped, want)
+	}
+
+	outside.Annotations[windowAnnotation] = "nightly"
+	if _, _, err := limitToWindows(pvcMap(outside), now); ExitCode(err) != exitConfig {
+		t.Errorf("got %v for an invalid window, want a config error", err)
+	}
+}